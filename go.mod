@@ -5,11 +5,16 @@ go 1.18
 require github.com/beevik/etree v1.1.0
 
 require (
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/peterh/liner v1.2.1
 	github.com/tvarney/maputil v1.1.1
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751 // indirect
 	github.com/alecthomas/units v0.0.0-20211218093645-b94a6e3cc137 // indirect
+	github.com/mattn/go-runewidth v0.0.3 // indirect
+	golang.org/x/sys v0.7.0 // indirect
 )
@@ -1,15 +1,27 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	goerrors "errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 
-	"github.com/tvarney/maputil/errctx"
+	"github.com/tvarney/sdtdmod/pkg/errors"
+	"github.com/tvarney/sdtdmod/pkg/gamedata"
+	"github.com/tvarney/sdtdmod/pkg/journal"
+	"github.com/tvarney/sdtdmod/pkg/loot"
 	"github.com/tvarney/sdtdmod/pkg/node"
 	"github.com/tvarney/sdtdmod/pkg/node/load"
+	"github.com/tvarney/sdtdmod/pkg/shell"
+	"github.com/tvarney/sdtdmod/pkg/watch"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -19,13 +31,61 @@ func main() {
 
 func run() int {
 	debug := kingpin.Flag("debug", "enable debug output").Short('D').Bool()
-	cnfgfile := kingpin.Flag("config", "path to the configuration file").Short('c').Default("./config.json").String()
+	cnfgfile := kingpin.Flag("config", "path to the configuration file or directory").Short('c').Default("./config.json").String()
+	setvars := kingpin.Flag("set", "override a config variable (name=value)").StringMap()
+	profile := kingpin.Flag("profile", "the name of the config profile to use").Short('p').String()
+	lenient := kingpin.Flag("lenient", "report unexpected config keys as warnings instead of errors").Bool()
+	jobs := kingpin.Flag("jobs", "the number of XML files to process at once").Short('j').Default(strconv.Itoa(runtime.NumCPU())).Int()
+	statedir := kingpin.Flag("state-dir", "the directory to keep the journal of applied changes in (default: <xmldir>/.sdtdmod)").String()
 
-	_ = kingpin.Command("validate", "validate the configuration file")
+	validate := kingpin.Command("validate", "validate the configuration file")
+	validatedir := validate.Flag("xmldir", "also check the configuration against the XML files in this directory").String()
+	_ = kingpin.Command("lint", "check the configuration file for likely mistakes")
 	apply := kingpin.Command("apply", "apply the configuration to the data")
 	applydir := apply.Arg("xmldir", "the directory containing XML files to update").Required().String()
+	applyreport := apply.Flag("report", "write a JSON report of the changes to this file").String()
+	applywatch := apply.Flag("watch", "apply again whenever the config or data changes").Bool()
+	revert := kingpin.Command("revert", "undo the changes made by apply")
+	revertdir := revert.Arg("xmldir", "the directory containing XML files to restore").Required().String()
+	revertto := revert.Flag("to", "undo every run from this one on instead of only the last").String()
+	revertforce := revert.Flag("force", "restore files even if they changed since they were written").Bool()
+	revertlist := revert.Flag("list", "list the runs which may be undone").Bool()
 	dryrun := kingpin.Command("dry-run", "display changes that would be made")
 	dryrundir := dryrun.Arg("xmldir", "the directory continaing XML files to update").Required().String()
+	dryrunreport := dryrun.Flag("report", "write a JSON report of the changes to this file").String()
+	dryrunwatch := dryrun.Flag("watch", "display changes again whenever the config or data changes").Bool()
+
+	query := kingpin.Command("query", "print the elements of the game data selected by a match")
+	querydir := query.Flag("xmldir", "the directory containing XML files to search").Required().String()
+	queryformat := query.Flag("format", "the output format").Default("table").Enum("table", "xml", "json")
+	querycontext := query.Flag("context", "the number of ancestors to show with each element").Default("0").Int()
+	querymatch := query.Arg("match", "a JSON match object, or a selector like 'item[@name=gunPistol]'").Required().String()
+
+	diffdata := kingpin.Command("diff-data", "compare two versions of the game data")
+	diffold := diffdata.Arg("old-dir", "the directory containing the old XML files").Required().String()
+	diffnew := diffdata.Arg("new-dir", "the directory containing the new XML files").Required().String()
+
+	lootcmd := kingpin.Command("loot", "show the chance of loot containers yielding items before and after the configuration")
+	lootdir := lootcmd.Arg("xmldir", "the directory containing XML files to read").Required().String()
+	lootcontainers := lootcmd.Flag("container", "a container to show; may be repeated").Strings()
+	lootitem := lootcmd.Flag("item", "the item to show").String()
+	lootlevel := lootcmd.Flag("level", "the loot level used for loot prob templates").Default("1").Float64()
+	lootchanged := lootcmd.Flag("changed", "only show chances the configuration changes").Bool()
+
+	recipescmd := kingpin.Command("recipes", "show the cost of the recipes the configuration changes, before and after")
+	recipesdir := recipescmd.Arg("xmldir", "the directory containing XML files to read").Required().String()
+	recipesnames := recipescmd.Flag("recipe", "a recipe to show whether or not it changes; may be repeated").Strings()
+
+	exportcmd := kingpin.Command("export-modlet", "write a modlet making the changes of the configuration, leaving the data as it is")
+	exportdir := exportcmd.Arg("xmldir", "the directory containing XML files to read").Required().String()
+	exportout := exportcmd.Arg("outdir", "the directory to write the modlet to").Required().String()
+	exportname := exportcmd.Flag("name", "the name of the modlet").Default("sdtdmod").String()
+
+	shellcmd := kingpin.Command("shell", "explore the game data and try out matches and actions interactively")
+	shelldir := shellcmd.Arg("xmldir", "the directory containing XML files to load").Required().String()
+
+	_ = kingpin.Command("test", "run the test cases of the configuration")
+	_ = kingpin.Command("schema", "print a JSON Schema for configuration files")
 
 	cmd := kingpin.Parse()
 	if *debug {
@@ -34,8 +94,41 @@ func run() int {
 		log.SetOutput(io.Discard)
 	}
 
+	switch cmd {
+	case "schema":
+		return Schema()
+	case "query":
+		return Query(*querymatch, *querydir, *queryformat, *querycontext, *jobs)
+	case "shell":
+		return Shell(*shelldir)
+	case "revert":
+		return Revert(openJournal(*statedir, *revertdir), *revertdir, *revertto, *revertforce, *revertlist)
+	}
+
+	opts := &load.Options{Vars: *setvars, EnvVars: load.EnvVars(os.Environ()), Profile: *profile, Lenient: *lenient}
+
+	if cmd == "lint" {
+		opts.Lint = true
+		return Lint(*cnfgfile, opts)
+	}
+
+	switch {
+	case cmd == "diff-data":
+		return DiffData(*cnfgfile, opts, *diffold, *diffnew)
+	case cmd == "loot":
+		return Loot(*cnfgfile, opts, *lootdir, *lootcontainers, *lootitem, *lootlevel, *lootchanged)
+	case cmd == "recipes":
+		return Recipes(*cnfgfile, opts, *recipesdir, *recipesnames)
+	case cmd == "export-modlet":
+		return ExportModlet(*cnfgfile, opts, *exportdir, *exportout, *exportname)
+	case cmd == "apply" && *applywatch:
+		return Watch(*cnfgfile, opts, openJournal(*statedir, *applydir), *applydir, *applyreport, *jobs)
+	case cmd == "dry-run" && *dryrunwatch:
+		return Watch(*cnfgfile, opts, nil, *dryrundir, *dryrunreport, *jobs)
+	}
+
 	log.Printf("Loading config file %q", *cnfgfile)
-	n, err := load.LoadFile(*cnfgfile, &errctx.ErrorPrinter{Stream: os.Stderr})
+	cfg, err := load.LoadFile(*cnfgfile, opts, &errors.ErrorPrinter{Stream: os.Stderr})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
 		return 1
@@ -43,22 +136,752 @@ func run() int {
 
 	switch cmd {
 	case "validate":
-		return Validate(n)
+		return Validate(cfg, *validatedir)
+	case "test":
+		return Test(cfg)
 	case "apply":
-		return Apply(n, false, *applydir)
+		return Apply(cfg, openJournal(*statedir, *applydir), *applydir, *applyreport, *jobs)
 	case "dry-run":
-		return Apply(n, true, *dryrundir)
+		return Apply(cfg, nil, *dryrundir, *dryrunreport, *jobs)
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %q", cmd)
 		return -1
 	}
 }
 
-func Apply(config []*node.Node, dryrun bool, dir string) int {
+// openJournal returns the journal kept in the state directory, or in the data
+// directory if no state directory is given.
+func openJournal(statedir, dir string) *journal.Journal {
+	if statedir == "" {
+		statedir = filepath.Join(dir, journal.DirName)
+	}
+	return &journal.Journal{Dir: statedir}
+}
+
+// Apply applies the config to the data, writing the changed files and
+// recording them in the journal. If the journal is nil, the changes are only
+// printed.
+//
+// Up to jobs files are read, updated, and written at once. The output for
+// each file is held until every file before it is done, so it comes out in
+// the same order however many jobs are used.
+func Apply(cfg *load.Config, j *journal.Journal, dir, report string, jobs int) int {
+	dryrun := j == nil
+	log.Printf("Loading game data from %q", dir)
+	docs, err := gamedata.LoadDirJobs(dir, jobs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading game data: %v\n", err)
+		return 1
+	}
+	if node.ReadsDocuments(cfg.Nodes) {
+		log.Printf("Updating files one at a time since the config reads from other files")
+		jobs = 1
+	}
+
+	type result struct {
+		stdout, stderr bytes.Buffer
+		report         *gamedata.Report
+		changed        bool
+	}
+	results := make([]result, len(docs))
+	changed := []*gamedata.Document{}
+	index := node.NewIndex(cfg.Nodes)
+	var summary *gamedata.Report
+	if report != "" {
+		summary = gamedata.NewReport(cfg.Nodes, cfg.Positions)
+	}
+	gamedata.ForEach(len(docs), jobs, func(idx int) {
+		doc, res := docs[idx], &results[idx]
+		printer := &gamedata.Printer{Stream: &res.stderr, Document: doc.Name, Documents: docs}
+		if dryrun {
+			printer.Changes = &res.stdout
+		}
+		var r node.Reporter = printer
+		if summary != nil {
+			res.report = gamedata.NewReport(cfg.Nodes, cfg.Positions)
+			r = gamedata.NewRecorder(res.report, cfg.Nodes, doc, printer)
+		}
+		res.changed = gamedata.ApplyIndex(index, doc, r)
+	}, func(idx int) bool {
+		doc, res := docs[idx], &results[idx]
+		os.Stderr.Write(res.stderr.Bytes())
+		os.Stdout.Write(res.stdout.Bytes())
+		if summary != nil {
+			summary.Merge(res.report)
+		}
+		switch {
+		case !res.changed:
+		case dryrun:
+			fmt.Fprintf(os.Stdout, "Would update %s\n", doc.Name)
+		default:
+			changed = append(changed, doc)
+		}
+		return true
+	})
+	if len(changed) > 0 {
+		if code := save(cfg, j, changed, jobs, nil); code != 0 {
+			return code
+		}
+	}
+
+	if summary != nil {
+		log.Printf("Writing report %q", report)
+		if err := summary.WriteFile(report); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// save records the changed documents in the journal and then writes them, up
+// to jobs at once. Documents which would be written unchanged are left out,
+// and no run is recorded if every document is. If a watcher is given, each
+// file is marked as written by the command before it is written.
+func save(cfg *load.Config, j *journal.Journal, docs []*gamedata.Document, jobs int, w *watch.Watcher) int {
+	run, err := journal.NewRun(cfg.Files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
+		return 1
+	}
+	before := make([][]byte, len(docs))
+	after := make([][]byte, len(docs))
+	errs := make([]error, len(docs))
+	write := make([]bool, len(docs))
+	ok := gamedata.ForEach(len(docs), jobs, func(idx int) {
+		if before[idx], errs[idx] = os.ReadFile(docs[idx].Path); errs[idx] == nil {
+			after[idx], errs[idx] = docs[idx].Bytes()
+		}
+	}, func(idx int) bool {
+		if errs[idx] != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", docs[idx].Name, errs[idx])
+			return false
+		}
+		if !bytes.Equal(before[idx], after[idx]) {
+			run.Add(docs[idx].Name, before[idx], after[idx])
+			write[idx] = true
+		}
+		return true
+	})
+	if !ok {
+		return 1
+	}
+	if len(run.Files) == 0 {
+		return 0
+	}
+	log.Printf("Recording run in %q", j.Dir)
+	if err := j.Record(run); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing journal: %v\n", err)
+		return 1
+	}
+
+	ok = gamedata.ForEach(len(docs), jobs, func(idx int) {
+		if !write[idx] {
+			return
+		}
+		log.Printf("Writing %q", docs[idx].Path)
+		if w != nil {
+			w.Written(docs[idx].Path, after[idx])
+		}
+		errs[idx] = os.WriteFile(docs[idx].Path, after[idx], 0644)
+	}, func(idx int) bool {
+		if errs[idx] != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", docs[idx].Name, errs[idx])
+			return false
+		}
+		if write[idx] {
+			fmt.Fprintf(os.Stdout, "Updated %s\n", docs[idx].Name)
+		}
+		return true
+	})
+	if !ok {
+		return 1
+	}
+	fmt.Fprintf(os.Stdout, "Recorded as run %s\n", run.ID)
+	return 0
+}
+
+// Revert undoes runs of apply recorded in the journal, or lists them.
+func Revert(j *journal.Journal, dir, to string, force, list bool) int {
+	if list {
+		runs, err := j.Runs()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading journal: %v\n", err)
+			return 1
+		}
+		for _, run := range runs {
+			names := make([]string, 0, len(run.Files))
+			for _, f := range run.Files {
+				names = append(names, f.Name)
+			}
+			hash := run.ConfigHash
+			if len(hash) > 12 {
+				hash = hash[:12]
+			}
+			fmt.Fprintf(os.Stdout, "%s  %s  %s  %s\n", run.ID, run.Config, hash, strings.Join(names, ", "))
+		}
+		return 0
+	}
+
+	runs, err := j.Revert(dir, to, force)
+	var merr *journal.ModifiedError
+	if goerrors.As(err, &merr) {
+		fmt.Fprintf(os.Stderr, "Error: files %v; use --force to restore them anyway\n", err)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reverting: %v\n", err)
+		return 1
+	}
+	for _, run := range runs {
+		for _, f := range run.Files {
+			fmt.Fprintf(os.Stdout, "Restored %s\n", f.Name)
+		}
+		fmt.Fprintf(os.Stdout, "Reverted run %s\n", run.ID)
+	}
 	return 0
 }
 
-func Validate(config []*node.Node) int {
+// Watch applies the config to the data each time either changes, printing the
+// changes which differ from the previous run. If the journal is nil, the
+// changes are only printed; otherwise each run which writes files is recorded
+// in the journal like a run of Apply, so it may be reverted.
+//
+// The data is read once and each run starts from a copy of it, so applying
+// the config again does not compound its changes. Files written by a run are
+// not treated as changes to the data; a file which a run no longer changes is
+// restored. If report is set, the report of each run replaces that of the
+// one before.
+func Watch(cnfgfile string, opts *load.Options, j *journal.Journal, dir, report string, jobs int) int {
+	log.Printf("Loading game data from %q", dir)
+	originals, err := gamedata.LoadDirJobs(dir, jobs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading game data: %v\n", err)
+		return 1
+	}
+	w, err := watch.New()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error watching files: %v\n", err)
+		return 1
+	}
+	defer w.Close()
+
+	var prev gamedata.ChangeSet
+	written := map[string]bool{}
+	files := []string{cnfgfile}
+	for {
+		cfg, err := load.LoadFile(cnfgfile, opts, &errors.ErrorPrinter{Stream: os.Stderr})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		} else {
+			files = cfg.Files
+			set, ok := watchRun(cfg, originals, j, written, w, report, jobs)
+			if !ok {
+				return 1
+			}
+			printChangeSet(set, prev)
+			prev = set
+		}
+
+		if err := w.Set(files, []string{dir}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error watching files: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(os.Stdout, "Watching for changes...\n")
+		var paths []string
+		for {
+			paths, err = w.Wait()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error watching files: %v\n", err)
+				return 1
+			}
+			// Other files under the data directory, such as the journal,
+			// do not start a run.
+			if paths == nil || watchedChange(paths, files) {
+				break
+			}
+		}
+		if paths == nil {
+			return 0
+		}
+		originals, err = reloadDocs(originals, dir, paths)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading game data: %v\n", err)
+			return 1
+		}
+	}
+}
+
+// watchRun applies the config to copies of the documents, up to jobs at once,
+// and returns the changes made. If the journal is set, changed documents are
+// saved along with those changed by an earlier run which are not anymore.
+//
+// Errors are printed, and false is returned if the run could not be
+// completed.
+func watchRun(cfg *load.Config, originals []*gamedata.Document, j *journal.Journal, written map[string]bool, w *watch.Watcher, report string, jobs int) (gamedata.ChangeSet, bool) {
+	docs := make([]*gamedata.Document, 0, len(originals))
+	for _, orig := range originals {
+		docs = append(docs, orig.Copy())
+	}
+	if node.ReadsDocuments(cfg.Nodes) {
+		jobs = 1
+	}
+
+	type result struct {
+		stderr  bytes.Buffer
+		set     gamedata.ChangeSet
+		report  *gamedata.Report
+		changed bool
+	}
+	results := make([]result, len(docs))
+	var summary *gamedata.Report
+	if report != "" {
+		summary = gamedata.NewReport(cfg.Nodes, cfg.Positions)
+	}
+	set := gamedata.ChangeSet{}
+	targets := []*gamedata.Document{}
+	changed := []bool{}
+	index := node.NewIndex(cfg.Nodes)
+	gamedata.ForEach(len(docs), jobs, func(idx int) {
+		doc, res := docs[idx], &results[idx]
+		res.set = gamedata.ChangeSet{}
+		var r node.Reporter = &gamedata.Collector{
+			Printer: &gamedata.Printer{Stream: &res.stderr, Document: doc.Name, Documents: docs},
+			Set:     res.set,
+		}
+		if summary != nil {
+			res.report = gamedata.NewReport(cfg.Nodes, cfg.Positions)
+			r = gamedata.NewRecorder(res.report, cfg.Nodes, doc, r)
+		}
+		res.changed = gamedata.ApplyIndex(index, doc, r)
+	}, func(idx int) bool {
+		doc, res := docs[idx], &results[idx]
+		os.Stderr.Write(res.stderr.Bytes())
+		for k, c := range res.set {
+			set[k] = c
+		}
+		if summary != nil {
+			summary.Merge(res.report)
+		}
+		switch {
+		case j == nil:
+		case res.changed:
+			targets = append(targets, doc)
+			changed = append(changed, true)
+		case written[doc.Name]:
+			targets = append(targets, originals[idx])
+			changed = append(changed, false)
+		}
+		return true
+	})
+
+	if len(targets) > 0 {
+		if code := save(cfg, j, targets, jobs, w); code != 0 {
+			return nil, false
+		}
+		for idx, doc := range targets {
+			written[doc.Name] = changed[idx]
+		}
+	}
+	if summary != nil {
+		log.Printf("Writing report %q", report)
+		if err := summary.WriteFile(report); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+			return nil, false
+		}
+	}
+	return set, true
+}
+
+// watchedChange checks if any of the changed paths is a config file or a
+// data file.
+func watchedChange(paths []string, files []string) bool {
+	for _, path := range paths {
+		if gamedata.IsDataFile(path) {
+			return true
+		}
+		for _, file := range files {
+			if abs, err := filepath.Abs(file); err == nil && abs == path {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reloadDocs reads the data files which changed on disk again.
+func reloadDocs(docs []*gamedata.Document, dir string, paths []string) ([]*gamedata.Document, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		name, err := filepath.Rel(root, path)
+		if err != nil || strings.HasPrefix(name, "..") || !gamedata.IsDataFile(path) {
+			continue
+		}
+		name = filepath.ToSlash(name)
+
+		kept := docs[:0]
+		for _, doc := range docs {
+			if doc.Name != name {
+				kept = append(kept, doc)
+			}
+		}
+		docs = kept
+		if _, err := os.Stat(path); err != nil {
+			log.Printf("Removed %q", name)
+			continue
+		}
+		log.Printf("Reloading %q", name)
+		doc, err := gamedata.LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		doc.Name = name
+		doc.Path = filepath.Join(dir, filepath.FromSlash(name))
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Name < docs[j].Name })
+	return docs, nil
+}
+
+func printChangeSet(set, prev gamedata.ChangeSet) {
+	changed, dropped := set.Since(prev)
+	for _, k := range changed {
+		fmt.Fprintf(os.Stdout, "%s:%s: %s\n", k.Document, k.XPath, gamedata.FormatChange(set[k]))
+	}
+	for _, k := range dropped {
+		fmt.Fprintf(os.Stdout, "%s:%s: @%s no longer changed\n", k.Document, k.XPath, k.Attr)
+	}
+	fmt.Fprintf(os.Stdout, "%d attributes changed, %d since the last run, %d no longer changed\n",
+		len(set), len(changed), len(dropped))
+}
+
+// Test runs the test cases of the config, printing a diff for each failure.
+func Test(cfg *load.Config) int {
+	if len(cfg.Tests) == 0 {
+		fmt.Fprintf(os.Stdout, "No tests found\n")
+		return 0
+	}
+	failed := 0
+	for idx, t := range cfg.Tests {
+		name := t.Name
+		if name == "" {
+			name = fmt.Sprintf("test %d", idx+1)
+		}
+		source := ""
+		if t.Source != nil {
+			source = " (" + t.Source.String() + ")"
+			if pos, ok := cfg.Positions.Lookup(t.Source); ok {
+				source = fmt.Sprintf(" (%s:%d:%d)", t.Source.Filename, pos.Line, pos.Column)
+			}
+		}
+
+		nodes := cfg.Nodes
+		if len(t.Nodes) > 0 {
+			nodes = cfg.AllNodes
+		}
+		result := gamedata.RunTest(t, nodes)
+		if result.Passed() {
+			fmt.Fprintf(os.Stdout, "PASS %s%s\n", name, source)
+			continue
+		}
+		failed++
+		fmt.Fprintf(os.Stdout, "FAIL %s%s\n", name, source)
+		for _, line := range result.Failures {
+			fmt.Fprintf(os.Stdout, "    %s\n", line)
+		}
+		for _, w := range result.Warnings {
+			fmt.Fprintf(os.Stdout, "    warning: %s\n", w)
+		}
+	}
+	fmt.Fprintf(os.Stdout, "%d passed, %d failed\n", len(cfg.Tests)-failed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func Lint(filename string, opts *load.Options) int {
+	log.Printf("Linting config file %q", filename)
+	collector := &errors.ErrorCollector{}
+	_, err := load.LoadFile(filename, opts, &errors.ErrorPrinter{Stream: os.Stdout}, collector)
+	var perr *errors.ParseCountError
+	if err != nil && !goerrors.As(err, &perr) {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stdout, "%d errors, %d warnings, %d info\n",
+		len(collector.Errors), len(collector.Warnings), len(collector.Infos))
+	if len(collector.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func Query(raw, dir, format string, context, jobs int) int {
+	m, err := load.LoadMatch("match", raw, &errors.ErrorPrinter{Stream: os.Stderr})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading match: %v\n", err)
+		return 1
+	}
+
+	log.Printf("Loading game data from %q", dir)
+	docs, err := gamedata.LoadDirJobs(dir, jobs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading game data: %v\n", err)
+		return 1
+	}
+
+	results := gamedata.QueryJobs(m, docs, jobs)
+	switch format {
+	case "xml":
+		err = gamedata.WriteQueryXML(os.Stdout, results, context)
+	case "json":
+		err = gamedata.WriteQueryJSON(os.Stdout, results, context)
+	default:
+		err = gamedata.WriteQueryTable(os.Stdout, results, context)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+		return 1
+	}
+	log.Printf("%d elements matched", len(results))
+	return 0
+}
+
+func DiffData(cnfgfile string, opts *load.Options, olddir, newdir string) int {
+	var nodes []*node.Node
+	if _, err := os.Stat(cnfgfile); err == nil {
+		log.Printf("Loading config file %q", cnfgfile)
+		cfg, err := load.LoadFile(cnfgfile, opts, &errors.ErrorPrinter{Stream: os.Stderr})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+			return 1
+		}
+		nodes = cfg.Nodes
+	}
+
+	log.Printf("Loading game data from %q and %q", olddir, newdir)
+	olddocs, err := gamedata.LoadDir(olddir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading game data: %v\n", err)
+		return 1
+	}
+	newdocs, err := gamedata.LoadDir(newdir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading game data: %v\n", err)
+		return 1
+	}
+
+	touched := gamedata.Touched(nodes, olddocs)
+	for e := range gamedata.Touched(nodes, newdocs) {
+		touched[e] = true
+	}
+	affected := 0
+	diffs := gamedata.Diff(olddocs, newdocs)
+	for _, d := range diffs {
+		if d.Affects(touched) {
+			affected++
+			fmt.Fprintf(os.Stdout, "%s [config]\n", d)
+		} else {
+			fmt.Fprintf(os.Stdout, "%s\n", d)
+		}
+	}
+	fmt.Fprintf(os.Stdout, "%d differences, %d affecting the config\n", len(diffs), affected)
+	return 0
+}
+
+// Loot prints the chance of looting containers yielding items, both for the
+// game data as it is and once the config has been applied to it. The config
+// is only used if the config file exists.
+func Loot(cnfgfile string, opts *load.Options, dir string, containers []string, item string, level float64, changed bool) int {
+	if len(containers) == 0 && item == "" {
+		fmt.Fprintf(os.Stderr, "Error: at least one of --container or --item is required\n")
+		return 1
+	}
+	docs, updated, ok := applyCopy(cnfgfile, opts, dir)
+	if !ok {
+		return 1
+	}
+	before, problems, err := gamedata.LootModel(docs, level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", p)
+	}
+	after, _, err := gamedata.LootModel(updated, level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	changes, err := loot.Compare(before, after, containers, item)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if changed {
+		kept := changes[:0]
+		for _, c := range changes {
+			if c.Before != c.After {
+				kept = append(kept, c)
+			}
+		}
+		changes = kept
+	}
+	if err := gamedata.WriteLootTable(os.Stdout, changes); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// Recipes prints the cost of the recipes the config changes, both for the
+// game data as it is and once the config has been applied to it. If names is
+// set, the recipes with those names are printed instead.
+func Recipes(cnfgfile string, opts *load.Options, dir string, names []string) int {
+	docs, updated, ok := applyCopy(cnfgfile, opts, dir)
+	if !ok {
+		return 1
+	}
+	if err := gamedata.WriteRecipeTable(os.Stdout, gamedata.CompareRecipes(docs, updated, names)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// ExportModlet writes a modlet to outdir which makes the changes the config
+// makes to the game data in dir. The game data is not changed.
+func ExportModlet(cnfgfile string, opts *load.Options, dir, outdir, name string) int {
+	log.Printf("Loading config file %q", cnfgfile)
+	cfg, err := load.LoadFile(cnfgfile, opts, &errors.ErrorPrinter{Stream: os.Stderr})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+
+	log.Printf("Loading game data from %q", dir)
+	docs, err := gamedata.LoadDir(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading game data: %v\n", err)
+		return 1
+	}
+
+	m, err := gamedata.ExportModlet(cfg.Nodes, docs, name, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	names := make([]string, 0, len(m.Files))
+	for file := range m.Files {
+		names = append(names, file)
+	}
+	sort.Strings(names)
+	for _, file := range names {
+		target := filepath.Join(outdir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if err := os.WriteFile(target, m.Files[file], 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", target, err)
+			return 1
+		}
+		fmt.Println(target)
+	}
+	return 0
+}
+
+// applyCopy reads the game data and returns it along with a copy the config
+// has been applied to. The config is only used if the config file exists.
+func applyCopy(cnfgfile string, opts *load.Options, dir string) ([]*gamedata.Document, []*gamedata.Document, bool) {
+	var nodes []*node.Node
+	if _, err := os.Stat(cnfgfile); err == nil {
+		log.Printf("Loading config file %q", cnfgfile)
+		cfg, err := load.LoadFile(cnfgfile, opts, &errors.ErrorPrinter{Stream: os.Stderr})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+			return nil, nil, false
+		}
+		nodes = cfg.Nodes
+	}
+
+	log.Printf("Loading game data from %q", dir)
+	docs, err := gamedata.LoadDir(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading game data: %v\n", err)
+		return nil, nil, false
+	}
+	updated := make([]*gamedata.Document, len(docs))
+	for idx, doc := range docs {
+		updated[idx] = doc.Copy()
+	}
+	index := node.NewIndex(nodes)
+	for _, doc := range updated {
+		gamedata.ApplyIndex(index, doc, &gamedata.Printer{Stream: os.Stderr, Document: doc.Name, Documents: updated})
+	}
+	return docs, updated, true
+}
+
+func Shell(dir string) int {
+	log.Printf("Loading game data from %q", dir)
+	docs, err := gamedata.LoadDir(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading game data: %v\n", err)
+		return 1
+	}
+
+	sh := shell.New(docs, os.Stdout)
+	if home, err := os.UserHomeDir(); err == nil {
+		sh.HistoryFile = filepath.Join(home, ".sdtdmod_history")
+	}
+	if err := sh.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func Schema() int {
+	d, err := json.MarshalIndent(load.Schema(), "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating schema: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stdout, "%s\n", string(d))
+	return 0
+}
+
+func Validate(cfg *load.Config, dir string) int {
+	if len(cfg.Vars) > 0 {
+		names := make([]string, 0, len(cfg.Vars))
+		for name := range cfg.Vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(os.Stdout, "Variables:\n")
+		for _, name := range names {
+			d, _ := json.Marshal(cfg.Vars[name])
+			fmt.Fprintf(os.Stdout, "  %s = %s\n", name, string(d))
+		}
+	}
+
+	if len(cfg.Profiles) > 0 {
+		fmt.Fprintf(os.Stdout, "Profiles:\n")
+		for _, p := range cfg.Profiles {
+			printProfile(p, cfg.AllNodes)
+		}
+	}
+	if cfg.Profile != nil {
+		fmt.Fprintf(os.Stdout, "Using profile %q\n", cfg.Profile.Name)
+	}
+
+	config := cfg.Nodes
 	switch len(config) {
 	case 0:
 		fmt.Fprintf(os.Stdout, "No config nodes loaded\n")
@@ -73,5 +896,48 @@ func Validate(config []*node.Node) int {
 		d, _ := json.MarshalIndent(nodes, "", "  ")
 		fmt.Fprintf(os.Stdout, "Config:\n%s\n", string(d))
 	}
+
+	if dir == "" {
+		return 0
+	}
+	log.Printf("Loading game data from %q", dir)
+	docs, err := gamedata.LoadDir(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading game data: %v\n", err)
+		return 1
+	}
+	handler := &errors.PositionHandler{Positions: cfg.Positions, Handler: &errors.ErrorPrinter{Stream: os.Stderr}}
+	if count := gamedata.Validate(cfg.Nodes, docs, handler); count > 0 {
+		fmt.Fprintf(os.Stderr, "%d problems found with the game data in %q\n", count, dir)
+		return 1
+	}
 	return 0
 }
+
+func printProfile(p *node.Profile, nodes []*node.Node) {
+	if p.Description != "" {
+		fmt.Fprintf(os.Stdout, "  %s: %s\n", p.Name, p.Description)
+	} else {
+		fmt.Fprintf(os.Stdout, "  %s:\n", p.Name)
+	}
+	if len(p.Enable) > 0 {
+		fmt.Fprintf(os.Stdout, "    enables: %s\n", strings.Join(p.Enable, ", "))
+	}
+	if len(p.Disable) > 0 {
+		fmt.Fprintf(os.Stdout, "    disables: %s\n", strings.Join(p.Disable, ", "))
+	}
+	if len(p.Vars) > 0 {
+		names := make([]string, 0, len(p.Vars))
+		for name := range p.Vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		values := make([]string, 0, len(names))
+		for _, name := range names {
+			d, _ := json.Marshal(p.Vars[name])
+			values = append(values, name+"="+string(d))
+		}
+		fmt.Fprintf(os.Stdout, "    vars: %s\n", strings.Join(values, ", "))
+	}
+	fmt.Fprintf(os.Stdout, "    nodes: %d of %d\n", len(p.Filter(nodes)), len(nodes))
+}
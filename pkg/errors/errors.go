@@ -1,6 +1,7 @@
 package errors
 
 import (
+	goerrors "errors"
 	"fmt"
 	"strings"
 
@@ -9,12 +10,27 @@ import (
 )
 
 // ErrorCollector is an ErrorHandler which collects errors.
+//
+// Errors are collected separately by severity.
 type ErrorCollector struct {
-	Errors []error
+	Errors   []error
+	Warnings []error
+	Infos    []error
 }
 
 func (e *ErrorCollector) Add(p *mpath.Path, err error) {
-	e.Errors = append(e.Errors, &ErrorWithContext{Err: err, Path: p.Copy()})
+	// mpath.Path.Copy drops the filename of an empty path, so restore it here.
+	c := p.Copy()
+	c.Filename = p.Filename
+	wrapped := &ErrorWithContext{Err: err, Path: c}
+	switch SeverityOf(err) {
+	case SeverityWarning:
+		e.Warnings = append(e.Warnings, wrapped)
+	case SeverityInfo:
+		e.Infos = append(e.Infos, wrapped)
+	default:
+		e.Errors = append(e.Errors, wrapped)
+	}
 }
 
 var _ errctx.ErrorHandler = &ErrorCollector{}
@@ -26,7 +42,7 @@ type ErrorWithContext struct {
 }
 
 func (e *ErrorWithContext) Error() string {
-	return fmt.Sprintf("%v: %v", e.Path, e.Err)
+	return formatError(e.Path, e.Err)
 }
 
 func (e *ErrorWithContext) Unwrap() error {
@@ -55,8 +71,93 @@ func (e *ParseCountError) Error() string {
 	return b.String()
 }
 
-type UnexpectedKeyError string
+// UnexpectedKeyError indicates that an object contains a key which is not
+// used.
+//
+// If a similar valid key exists, it is given as the suggestion.
+type UnexpectedKeyError struct {
+	Key        string
+	Suggestion string
+}
 
 func (e UnexpectedKeyError) Error() string {
-	return fmt.Sprintf("unexpected key %q", string(e))
+	if e.Suggestion == "" {
+		return fmt.Sprintf("unexpected key %q", e.Key)
+	}
+	return fmt.Sprintf("unexpected key %q, did you mean %q?", e.Key, e.Suggestion)
+}
+
+// Severity is how serious a reported problem is.
+type Severity int
+
+const (
+	// SeverityError is a problem which prevents the configuration from being
+	// used.
+	SeverityError Severity = iota
+	// SeverityWarning is a likely mistake which does not prevent the
+	// configuration from being used.
+	SeverityWarning
+	// SeverityInfo is a suggestion.
+	SeverityInfo
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "info"
+	}
+	return "error"
+}
+
+// Diagnostic wraps an error with its severity.
+//
+// Only diagnostics with SeverityError should be counted as errors by the
+// error context they are reported to.
+type Diagnostic struct {
+	Severity Severity
+	Err      error
+}
+
+func (e *Diagnostic) Error() string {
+	return e.Severity.String() + ": " + e.Err.Error()
+}
+
+func (e *Diagnostic) Unwrap() error {
+	return e.Err
+}
+
+// SeverityOf returns the severity of an error. Errors which are not
+// diagnostics are SeverityError.
+func SeverityOf(err error) Severity {
+	var d *Diagnostic
+	if goerrors.As(err, &d) {
+		return d.Severity
+	}
+	return SeverityError
+}
+
+// MissingSourceError indicates that an action could not find the element it
+// reads its value from.
+type MissingSourceError string
+
+func (e MissingSourceError) Error() string {
+	return fmt.Sprintf("no source element found for %q", string(e))
+}
+
+// MissingAttributeError indicates that an element does not have an attribute
+// which was required.
+type MissingAttributeError string
+
+func (e MissingAttributeError) Error() string {
+	return fmt.Sprintf("missing attribute %q", string(e))
+}
+
+// UndefinedVariableError indicates that a variable reference could not be
+// resolved.
+type UndefinedVariableError string
+
+func (e UndefinedVariableError) Error() string {
+	return fmt.Sprintf("undefined variable %q", string(e))
 }
@@ -0,0 +1,111 @@
+package errors
+
+import (
+	goerrors "errors"
+	"fmt"
+	"io"
+
+	"github.com/tvarney/maputil/errctx"
+	"github.com/tvarney/maputil/mpath"
+)
+
+// Position is a line and column in a source file, both starting at 1.
+type Position struct {
+	Line   int
+	Column int
+}
+
+// Positions maps paths of the values in a set of files to their position in
+// the source.
+type Positions struct {
+	files map[string]map[string]Position
+}
+
+// NewPositions returns an empty set of positions.
+func NewPositions() *Positions {
+	return &Positions{files: map[string]map[string]Position{}}
+}
+
+// Set records the position of the value at the path in the file.
+func (p *Positions) Set(filename string, path *mpath.Path, pos Position) {
+	table, ok := p.files[filename]
+	if !ok {
+		table = map[string]Position{}
+		p.files[filename] = table
+	}
+	table[path.Style.Format(path.Elements)] = pos
+}
+
+// Lookup returns the position of the value at the path.
+//
+// If the exact path is not known, such as for a missing key, the position of
+// the closest known parent is returned.
+func (p *Positions) Lookup(path *mpath.Path) (Position, bool) {
+	table, ok := p.files[path.Filename]
+	if !ok {
+		return Position{}, false
+	}
+	for n := len(path.Elements); n >= 0; n-- {
+		if pos, ok := table[path.Style.Format(path.Elements[:n])]; ok {
+			return pos, true
+		}
+	}
+	return Position{}, false
+}
+
+// PositionError is an error annotated with its location in a source file.
+type PositionError struct {
+	Filename string
+	Position
+	Err error
+}
+
+func (e *PositionError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %v", e.Filename, e.Line, e.Column, e.Err)
+}
+
+func (e *PositionError) Unwrap() error {
+	return e.Err
+}
+
+// PositionHandler is an ErrorHandler which annotates errors with the source
+// position of their path before passing them on.
+type PositionHandler struct {
+	Positions *Positions
+	Handler   errctx.ErrorHandler
+}
+
+func (h *PositionHandler) Add(p *mpath.Path, err error) {
+	if pos, ok := h.Positions.Lookup(p); ok {
+		err = &PositionError{Filename: p.Filename, Position: pos, Err: err}
+	}
+	h.Handler.Add(p, err)
+}
+
+var _ errctx.ErrorHandler = &PositionHandler{}
+
+// ErrorPrinter is an ErrorHandler which prints errors to a stream.
+//
+// Errors with a source position are printed starting with that position in
+// the `file:line:column` form understood by editors.
+type ErrorPrinter struct {
+	Stream io.Writer
+}
+
+func (h *ErrorPrinter) Add(p *mpath.Path, err error) {
+	fmt.Fprintln(h.Stream, formatError(p, err))
+}
+
+var _ errctx.ErrorHandler = &ErrorPrinter{}
+
+func formatError(p *mpath.Path, err error) string {
+	var perr *PositionError
+	if !goerrors.As(err, &perr) {
+		return fmt.Sprintf("%v: %v", p, err)
+	}
+	path := p.Style.Format(p.Elements)
+	if path == "" {
+		return fmt.Sprintf("%s:%d:%d: %v", perr.Filename, perr.Line, perr.Column, perr.Err)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %v", perr.Filename, perr.Line, perr.Column, path, perr.Err)
+}
@@ -0,0 +1,99 @@
+package gamedata
+
+import (
+	"sort"
+
+	"github.com/tvarney/sdtdmod/pkg/node"
+)
+
+// ChangeKey identifies an attribute of an element of a document.
+type ChangeKey struct {
+	Document string
+	XPath    string
+	Attr     string
+}
+
+// ChangeSet holds the overall change to every attribute changed by a run.
+//
+// Several changes to the same attribute are combined into one from the
+// original value to the final value. Attributes which end with their
+// original value are removed.
+type ChangeSet map[ChangeKey]node.Change
+
+// Add combines the change to an attribute of the document with any earlier
+// change to it.
+func (s ChangeSet) Add(document string, c node.Change) {
+	k := ChangeKey{Document: document, XPath: XPath(c.Element), Attr: c.Attr}
+	prev, ok := s[k]
+	if !ok {
+		s[k] = c
+		return
+	}
+
+	c.Old, c.Added = prev.Old, prev.Added
+	if c.Removed && c.Added {
+		delete(s, k)
+		return
+	}
+	if !c.Removed && !c.Added && c.Old == c.New {
+		delete(s, k)
+		return
+	}
+	c.Removed = c.Removed && !c.Added
+	s[k] = c
+}
+
+// Keys returns the keys of the set in order.
+func (s ChangeSet) Keys() []ChangeKey {
+	keys := make([]ChangeKey, 0, len(s))
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.Document != b.Document {
+			return a.Document < b.Document
+		}
+		if a.XPath != b.XPath {
+			return a.XPath < b.XPath
+		}
+		return a.Attr < b.Attr
+	})
+	return keys
+}
+
+// Since returns the keys of the changes of the set which are new or differ
+// from those of a previous set, and the keys of the previous changes which the
+// set no longer makes.
+func (s ChangeSet) Since(prev ChangeSet) ([]ChangeKey, []ChangeKey) {
+	changed := []ChangeKey{}
+	for _, k := range s.Keys() {
+		c := s[k]
+		if p, ok := prev[k]; ok && p.New == c.New && p.Removed == c.Removed {
+			continue
+		}
+		changed = append(changed, k)
+	}
+	dropped := []ChangeKey{}
+	for _, k := range prev.Keys() {
+		if _, ok := s[k]; !ok {
+			dropped = append(dropped, k)
+		}
+	}
+	return changed, dropped
+}
+
+// Collector is a Printer which also adds every change to a ChangeSet.
+type Collector struct {
+	*Printer
+	Set ChangeSet
+}
+
+// Change adds the change to the set and passes it on to the Printer.
+func (c *Collector) Change(change node.Change) {
+	c.Set.Add(c.Document, change)
+	c.Printer.Change(change)
+}
+
+var _ node.Reporter = &Collector{}
+var _ node.Resolver = &Collector{}
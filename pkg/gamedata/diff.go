@@ -0,0 +1,211 @@
+package gamedata
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/beevik/etree"
+	"github.com/tvarney/sdtdmod/pkg/node"
+)
+
+// DiffKind is the kind of a difference between two versions of the data.
+type DiffKind int
+
+const (
+	// DiffAdded is an element or document which only exists in the new data.
+	DiffAdded DiffKind = iota
+	// DiffRemoved is an element or document which only exists in the old data.
+	DiffRemoved
+	// DiffChanged is an attribute which was added, removed, or modified.
+	DiffChanged
+)
+
+// Difference is a single difference between two versions of the data.
+//
+// Path identifies the element by the identity of it and its ancestors rather
+// than by position. For DiffChanged, Change describes the attribute and its
+// Element is the element of the new data.
+type Difference struct {
+	Kind     DiffKind
+	Document string
+	Path     string
+	Old      *etree.Element
+	New      *etree.Element
+	Change   node.Change
+}
+
+func (d Difference) String() string {
+	switch d.Kind {
+	case DiffAdded:
+		return fmt.Sprintf("+ %s:%s", d.Document, d.Path)
+	case DiffRemoved:
+		return fmt.Sprintf("- %s:%s", d.Document, d.Path)
+	}
+	return fmt.Sprintf("~ %s:%s %s", d.Document, d.Path, FormatChange(d.Change))
+}
+
+// Diff compares two versions of the data.
+//
+// Documents are paired by name, and elements are paired with the sibling in
+// the other version that has the same identity: the tag along with the
+// `name` or `class` attribute, or the position among siblings with the same
+// tag for elements with neither. Added and removed elements are reported
+// without their contents.
+func Diff(old, new []*Document) []Difference {
+	diffs := []Difference{}
+	newDocs := map[string]*Document{}
+	for _, doc := range new {
+		newDocs[doc.Name] = doc
+	}
+	oldDocs := map[string]bool{}
+	for _, o := range old {
+		oldDocs[o.Name] = true
+		n, ok := newDocs[o.Name]
+		if !ok {
+			diffs = append(diffs, Difference{Kind: DiffRemoved, Document: o.Name, Path: "/"})
+			continue
+		}
+		oroot, nroot := o.Tree.Root(), n.Tree.Root()
+		if oroot == nil || nroot == nil {
+			continue
+		}
+		diffs = diffElement(diffs, o.Name, "/"+oroot.Tag, oroot, nroot)
+	}
+	for _, n := range new {
+		if !oldDocs[n.Name] {
+			diffs = append(diffs, Difference{Kind: DiffAdded, Document: n.Name, Path: "/"})
+		}
+	}
+	return diffs
+}
+
+func diffElement(diffs []Difference, doc, path string, o, n *etree.Element) []Difference {
+	oldAttrs, newAttrs := attrMap(o), attrMap(n)
+	names := make([]string, 0, len(oldAttrs)+len(newAttrs))
+	for name := range oldAttrs {
+		names = append(names, name)
+	}
+	for name := range newAttrs {
+		if _, ok := oldAttrs[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ov, inOld := oldAttrs[name]
+		nv, inNew := newAttrs[name]
+		if inOld && inNew && ov == nv {
+			continue
+		}
+		diffs = append(diffs, Difference{
+			Kind: DiffChanged, Document: doc, Path: path, Old: o, New: n,
+			Change: node.Change{Element: n, Attr: name, Old: ov, New: nv, Added: !inOld, Removed: !inNew},
+		})
+	}
+
+	oldKeys, oldChildren := identities(o)
+	newKeys, newChildren := identities(n)
+	newByKey := make(map[string]*etree.Element, len(newKeys))
+	for idx, k := range newKeys {
+		newByKey[k] = newChildren[idx]
+	}
+	oldByKey := make(map[string]bool, len(oldKeys))
+	for idx, k := range oldKeys {
+		oldByKey[k] = true
+		child := oldChildren[idx]
+		if match, ok := newByKey[k]; ok {
+			diffs = diffElement(diffs, doc, path+"/"+k, child, match)
+		} else {
+			diffs = append(diffs, Difference{Kind: DiffRemoved, Document: doc, Path: path + "/" + k, Old: child})
+		}
+	}
+	for idx, k := range newKeys {
+		if !oldByKey[k] {
+			diffs = append(diffs, Difference{Kind: DiffAdded, Document: doc, Path: path + "/" + k, New: newChildren[idx]})
+		}
+	}
+	return diffs
+}
+
+// identities returns the identity of every child element, in order.
+func identities(element *etree.Element) ([]string, []*etree.Element) {
+	children := element.ChildElements()
+	keys := make([]string, 0, len(children))
+	seen := map[string]int{}
+	for _, child := range children {
+		k := child.Tag
+		for _, attr := range []string{"name", "class"} {
+			if v := child.SelectAttrValue(attr, ""); v != "" {
+				k = fmt.Sprintf("%s[@%s=%q]", child.Tag, attr, v)
+				break
+			}
+		}
+		seen[k]++
+		if seen[k] > 1 || k == child.Tag {
+			k += "[" + strconv.Itoa(seen[k]) + "]"
+		}
+		keys = append(keys, k)
+	}
+	return keys, children
+}
+
+// Affects checks if the difference concerns an element in touched.
+//
+// Added and removed elements are also checked for touched descendants.
+func (d Difference) Affects(touched map[*etree.Element]bool) bool {
+	if d.Kind == DiffChanged {
+		return touched[d.Old] || touched[d.New]
+	}
+	return touchedTree(d.Old, touched) || touchedTree(d.New, touched)
+}
+
+func touchedTree(element *etree.Element, touched map[*etree.Element]bool) bool {
+	if element == nil {
+		return false
+	}
+	if touched[element] {
+		return true
+	}
+	for _, child := range element.ChildElements() {
+		if touchedTree(child, touched) {
+			return true
+		}
+	}
+	return false
+}
+
+// Touched returns every element of the documents which a node with actions
+// matches, following the same rules as Apply.
+func Touched(nodes []*node.Node, docs []*Document) map[*etree.Element]bool {
+	touched := map[*etree.Element]bool{}
+	for _, doc := range docs {
+		if root := doc.Tree.Root(); root != nil {
+			touchTree(nodes, root, touched)
+		}
+	}
+	return touched
+}
+
+func touchTree(nodes []*node.Node, element *etree.Element, touched map[*etree.Element]bool) {
+	for _, n := range nodes {
+		touch(n, element, touched)
+	}
+	for _, child := range element.ChildElements() {
+		touchTree(nodes, child, touched)
+	}
+}
+
+func touch(n *node.Node, element *etree.Element, touched map[*etree.Element]bool) {
+	if n.Match != nil && !n.Match.Check(element) {
+		return
+	}
+	if len(n.Actions) > 0 {
+		touched[element] = true
+	}
+	for _, child := range element.ChildElements() {
+		for _, c := range n.Children {
+			touch(c, child, touched)
+		}
+	}
+}
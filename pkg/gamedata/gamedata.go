@@ -0,0 +1,137 @@
+// Package gamedata loads, updates, and saves the XML files of the game.
+//
+// The localization file of the game is loaded as a document too, with one
+// element per row; see LocalizationName.
+package gamedata
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/tvarney/sdtdmod/pkg/node"
+)
+
+// Document is a single XML file from a game data directory, or the
+// localization file.
+type Document struct {
+	// Name is the path of the file relative to the data directory.
+	Name string
+	// Path is the path of the file on disk.
+	Path string
+	Tree *etree.Document
+
+	source *source
+	table  *table
+}
+
+// LoadDir reads every XML file and localization file found under the given
+// directory.
+//
+// Documents are returned in lexical order of their names.
+func LoadDir(dir string) ([]*Document, error) {
+	return LoadDirJobs(dir, 1)
+}
+
+// LoadFile reads a single XML file, or the localization file if the file is
+// named LocalizationName.
+func LoadFile(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Base(path), LocalizationName) {
+		tree, tbl, err := loadLocalization(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return &Document{Name: filepath.Base(path), Path: path, Tree: tree, table: tbl}, nil
+	}
+	tree := etree.NewDocument()
+	if err := tree.ReadFromBytes(data); err != nil {
+		return nil, err
+	}
+	return &Document{
+		Name:   filepath.Base(path),
+		Path:   path,
+		Tree:   tree,
+		source: newSource(data, tree),
+	}, nil
+}
+
+// Copy returns a copy of the document which may be modified without changing
+// the original.
+func (d *Document) Copy() *Document {
+	c := &Document{Name: d.Name, Path: d.Path, Tree: d.Tree.Copy()}
+	if d.source != nil {
+		c.source = d.source.copy(d.Tree, c.Tree)
+	}
+	if d.table != nil {
+		c.table = d.table.copy(d.Tree, c.Tree)
+	}
+	return c
+}
+
+// Bytes returns the content of the document as it would be written.
+//
+// The parts of the file the document was read from which were not changed
+// are kept byte for byte, including comments, whitespace, quoting, and line
+// endings, so that the file only differs where elements and attributes were
+// changed. If the file could not be indexed when it was read, the whole
+// document is serialized instead.
+//
+// The localization file is written back as a table, keeping the quoting and
+// line of every row which did not change.
+func (d *Document) Bytes() ([]byte, error) {
+	if d.table != nil {
+		return d.table.write(d.Tree, nil)
+	}
+	if d.source != nil {
+		if data, ok := d.source.write(d.Tree); ok {
+			return data, nil
+		}
+	}
+	return d.Tree.WriteToBytes()
+}
+
+// Save writes the document back to the file it was read from.
+func (d *Document) Save() error {
+	data, err := d.Bytes()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(d.Path, data, 0644)
+}
+
+// Apply applies the configuration nodes to every element of the document.
+//
+// This returns true if any element of the document was modified.
+func Apply(nodes []*node.Node, doc *Document, r node.Reporter) bool {
+	return ApplyIndex(node.NewIndex(nodes), doc, r)
+}
+
+// ApplyIndex applies the indexed nodes to every element of the document like
+// Apply. The same index may be used for every document.
+func ApplyIndex(index *node.Index, doc *Document, r node.Reporter) bool {
+	root := doc.Tree.Root()
+	if root == nil {
+		return false
+	}
+	return applyElement(index, root, r)
+}
+
+func applyElement(index *node.Index, element *etree.Element, r node.Reporter) bool {
+	updated := index.Apply(element, r)
+	// The children are found before any of them is visited, so elements
+	// inserted by actions, such as clones, are not updated in the same pass.
+	// Otherwise a clone matching the node which made it would be cloned
+	// again, without end.
+	for _, child := range element.ChildElements() {
+		if applyElement(index, child, r) {
+			updated = true
+		}
+	}
+	return updated
+}
@@ -0,0 +1,37 @@
+package gamedata
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/tvarney/sdtdmod/pkg/node"
+)
+
+func testDoc(t *testing.T, xml string) *Document {
+	t.Helper()
+	tree := etree.NewDocument()
+	if err := tree.ReadFromString(xml); err != nil {
+		t.Fatal(err)
+	}
+	return &Document{Name: "test.xml", Tree: tree}
+}
+
+// TestApplyCloneOnce checks that an element cloned by a node is not visited
+// by the same pass, which would clone the clone again without end.
+func TestApplyCloneOnce(t *testing.T) {
+	doc := testDoc(t, `<items><item name="a"/><item name="b"/></items>`)
+	nodes := []*node.Node{{
+		Match:   &node.TagMatch{Value: "item"},
+		Actions: []node.Action{&node.CloneElement{Set: map[string]string{"name": "{@name}_x"}}},
+	}}
+	Apply(nodes, doc, node.Discard{})
+
+	names := []string{}
+	for _, item := range doc.Tree.Root().SelectElements("item") {
+		names = append(names, item.SelectAttrValue("name", ""))
+	}
+	if got, want := strings.Join(names, ","), "a,a_x,b,b_x"; got != want {
+		t.Errorf("items are %s, expected %s", got, want)
+	}
+}
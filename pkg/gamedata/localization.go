@@ -0,0 +1,119 @@
+package gamedata
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/tvarney/sdtdmod/pkg/localization"
+)
+
+// LocalizationName is the name of the localization file of the game.
+const LocalizationName = "Localization.txt"
+
+const (
+	// LocalizationTag is the tag of the root element of a localization
+	// document.
+	LocalizationTag = "Localization"
+	// EntryTag is the tag of the element holding each row of a localization
+	// document.
+	EntryTag = "entry"
+)
+
+// IsDataFile checks if the file at the path is one which LoadFile reads: an
+// XML file or the localization file.
+func IsDataFile(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".xml") || strings.EqualFold(filepath.Base(path), LocalizationName)
+}
+
+// table is the localization file a document was read from.
+//
+// Each row of the file is an `entry` element under the root, with an
+// attribute for every non-empty field named by the column of the field, so
+// that entries may be matched by `Key` and updated per language like any
+// other element.
+type table struct {
+	data *localization.Table
+	rows map[*etree.Element]*localization.Row
+}
+
+// loadLocalization reads the content of a localization file.
+func loadLocalization(data []byte) (*etree.Document, *table, error) {
+	t, err := localization.Parse(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t.Column(localization.KeyColumn) < 0 {
+		return nil, nil, fmt.Errorf("no %q column", localization.KeyColumn)
+	}
+
+	tree := etree.NewDocument()
+	root := tree.CreateElement(LocalizationTag)
+	tbl := &table{data: t, rows: make(map[*etree.Element]*localization.Row, len(t.Rows))}
+	for _, row := range t.Rows {
+		entry := root.CreateElement(EntryTag)
+		for col, value := range row.Values() {
+			if value != "" && col < len(t.Columns) {
+				entry.CreateAttr(t.Columns[col], value)
+			}
+		}
+		tbl.rows[entry] = row
+	}
+	return tree, tbl, nil
+}
+
+// copy returns the table of a copy of the tree it was read into.
+func (t *table) copy(from, to *etree.Document) *table {
+	c := &table{data: t.data, rows: make(map[*etree.Element]*localization.Row, len(t.rows))}
+	if from.Root() == nil || to.Root() == nil {
+		return c
+	}
+	children := to.Root().ChildElements()
+	for idx, child := range from.Root().ChildElements() {
+		if row, ok := t.rows[child]; ok && idx < len(children) {
+			c.rows[children[idx]] = row
+		}
+	}
+	return c
+}
+
+// write returns the content of the localization file for the tree.
+//
+// Entries keep the row they were read from, so that unchanged rows are
+// written as they were; new entries are written as new rows. An attribute
+// which does not name a column is an error, since the file has nowhere to
+// hold it. If keep is set, only the entries it returns true for are written.
+func (t *table) write(tree *etree.Document, keep func(*etree.Element) bool) ([]byte, error) {
+	root := tree.Root()
+	if root == nil {
+		return nil, fmt.Errorf("no root element")
+	}
+	children := root.ChildElements()
+	edits := make([]localization.Edit, 0, len(children))
+	for _, entry := range children {
+		if entry.Tag != EntryTag {
+			return nil, fmt.Errorf("%s: unexpected element in %s", XPath(entry), LocalizationName)
+		}
+		if keep != nil && !keep(entry) {
+			continue
+		}
+		values := make([]string, len(t.data.Columns))
+		for _, attr := range entry.Attr {
+			col := t.data.Column(attr.FullKey())
+			if col < 0 {
+				return nil, fmt.Errorf("%s: no column named %q", XPath(entry), attr.FullKey())
+			}
+			values[col] = attr.Value
+		}
+		row := t.rows[entry]
+		if row != nil {
+			// Fields past the last column are kept as they were.
+			if extra := row.Values(); len(extra) > len(values) {
+				values = append(values, extra[len(values):]...)
+			}
+		}
+		edits = append(edits, localization.Edit{Row: row, Values: values})
+	}
+	return t.data.Write(edits), nil
+}
@@ -0,0 +1,49 @@
+package gamedata
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tvarney/sdtdmod/pkg/loot"
+)
+
+// LootName is the name of the data file holding the loot of the game.
+const LootName = "loot.xml"
+
+// LootModel returns the model of the loot file among the documents.
+//
+// Problems found while resolving the loot are returned alongside the model.
+func LootModel(docs []*Document, level float64) (*loot.Model, []error, error) {
+	for _, doc := range docs {
+		if strings.EqualFold(path.Base(doc.Name), LootName) && doc.Tree.Root() != nil {
+			model, errs := loot.New(doc.Tree.Root(), level)
+			return model, errs, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("no %s found", LootName)
+}
+
+// WriteLootTable writes the chances of looting containers yielding items, one
+// line per container and item.
+func WriteLootTable(w io.Writer, changes []loot.Change) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "CONTAINER\tITEM\tBEFORE\tAFTER\tCHANGE\n")
+	for _, c := range changes {
+		change := "-"
+		switch {
+		case c.Before > 0:
+			change = fmt.Sprintf("x%.3g", c.After/c.Before)
+		case c.After > 0:
+			change = "new"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", c.Container, c.Item, percent(c.Before), percent(c.After), change)
+	}
+	return tw.Flush()
+}
+
+func percent(chance float64) string {
+	return fmt.Sprintf("%.3f%%", chance*100)
+}
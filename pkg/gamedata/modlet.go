@@ -0,0 +1,283 @@
+package gamedata
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/tvarney/sdtdmod/pkg/node"
+)
+
+// ModletConfigDir is the directory of a modlet holding its data files.
+const ModletConfigDir = "Config"
+
+// Modlet is a set of files which make changes to the game data when placed
+// in the Mods directory of the game.
+//
+// Files maps the path of each file, relative to the directory of the modlet,
+// to its content.
+type Modlet struct {
+	Files map[string][]byte
+}
+
+// ExportModlet applies the nodes to copies of the documents and returns a
+// modlet making the same changes.
+//
+// Each changed XML file becomes a list of XPath patches: `set`,
+// `setattribute`, and `removeattribute` for attributes of existing elements,
+// `insertAfter` or `append` for elements the nodes added, and `remove` for
+// elements the nodes removed. The
+// localization file becomes a file holding only the entries the nodes added
+// or changed, which the game merges with its own by key. The documents
+// themselves are not modified; warnings from the nodes are written to warn.
+func ExportModlet(nodes []*node.Node, docs []*Document, name string, warn io.Writer) (*Modlet, error) {
+	copies := make([]*Document, len(docs))
+	pairs := make([]map[*etree.Element]*etree.Element, len(docs))
+	for idx, doc := range docs {
+		copies[idx] = doc.Copy()
+		pairs[idx] = map[*etree.Element]*etree.Element{}
+		if doc.Tree.Root() != nil {
+			pairElements(copies[idx].Tree.Root(), doc.Tree.Root(), pairs[idx])
+		}
+	}
+	index := node.NewIndex(nodes)
+	for _, doc := range copies {
+		ApplyIndex(index, doc, &Printer{Stream: warn, Document: doc.Name, Documents: copies})
+	}
+
+	m := &Modlet{Files: map[string][]byte{"ModInfo.xml": modInfo(name)}}
+	for idx, doc := range copies {
+		target := path.Join(ModletConfigDir, strings.TrimPrefix(doc.Name, ModletConfigDir+"/"))
+		var data []byte
+		var err error
+		if doc.table != nil {
+			data, err = localizationPatch(doc, pairs[idx])
+		} else {
+			data, err = xmlPatch(doc, pairs[idx])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", doc.Name, err)
+		}
+		if data != nil {
+			m.Files[target] = data
+		}
+	}
+	return m, nil
+}
+
+// pairElements maps each element of a copy to the element of the original it
+// was copied from.
+func pairElements(copied, original *etree.Element, pairs map[*etree.Element]*etree.Element) {
+	pairs[copied] = original
+	originals := original.ChildElements()
+	for idx, child := range copied.ChildElements() {
+		pairElements(child, originals[idx], pairs)
+	}
+}
+
+func modInfo(name string) []byte {
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	root := doc.CreateElement("xml")
+	for _, field := range [][2]string{
+		{"Name", name},
+		{"DisplayName", name},
+		{"Description", "Generated by sdtdmod"},
+		{"Author", "sdtdmod"},
+		{"Version", "1.0.0"},
+	} {
+		root.CreateElement(field[0]).CreateAttr("value", field[1])
+	}
+	doc.Indent(1)
+	doc.WriteSettings.CanonicalAttrVal = true
+	data, _ := doc.WriteToBytes()
+	return data
+}
+
+// localizationPatch returns the rows of the localization file for entries
+// which were added or changed, or nil if there are none.
+func localizationPatch(doc *Document, pairs map[*etree.Element]*etree.Element) ([]byte, error) {
+	changed := false
+	keep := func(entry *etree.Element) bool {
+		original, ok := pairs[entry]
+		if !ok || !sameEntry(entry, original) {
+			changed = true
+			return true
+		}
+		return false
+	}
+	data, err := doc.table.write(doc.Tree, keep)
+	if err != nil || !changed {
+		return nil, err
+	}
+	return data, nil
+}
+
+func sameEntry(a, b *etree.Element) bool {
+	if len(a.Attr) != len(b.Attr) {
+		return false
+	}
+	for _, attr := range a.Attr {
+		if other := b.SelectAttr(attr.FullKey()); other == nil || other.Value != attr.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// xmlPatch returns the XPath patches which turn the original of the document
+// into the document, or nil if there are none.
+func xmlPatch(doc *Document, pairs map[*etree.Element]*etree.Element) ([]byte, error) {
+	root := doc.Tree.Root()
+	if root == nil {
+		return nil, nil
+	}
+	out := etree.NewDocument()
+	configs := out.CreateElement("configs")
+	patchElement(root, pairs, configs)
+	if len(configs.Child) == 0 {
+		return nil, nil
+	}
+	out.Indent(1)
+	out.WriteSettings.CanonicalAttrVal = true
+	return out.WriteToBytes()
+}
+
+// patchElement adds the patches for an element which exists in the original
+// and its descendants.
+func patchElement(element *etree.Element, pairs map[*etree.Element]*etree.Element, configs *etree.Element) {
+	original := pairs[element]
+	target := modletPath(original)
+	for _, attr := range element.Attr {
+		old := original.SelectAttr(attr.FullKey())
+		switch {
+		case old == nil:
+			e := configs.CreateElement("setattribute")
+			e.CreateAttr("xpath", target)
+			e.CreateAttr("name", attr.FullKey())
+			e.SetText(attr.Value)
+		case old.Value != attr.Value:
+			e := configs.CreateElement("set")
+			e.CreateAttr("xpath", target+"/@"+attr.FullKey())
+			e.SetText(attr.Value)
+		}
+	}
+	for _, attr := range original.Attr {
+		if element.SelectAttr(attr.FullKey()) == nil {
+			configs.CreateElement("removeattribute").CreateAttr("xpath", target+"/@"+attr.FullKey())
+		}
+	}
+
+	// The children are patched from last to first, so that the position of
+	// each element in the original is still its position when its patches
+	// are applied. Elements removed by the nodes are placed after the kept
+	// element before them.
+	type step struct {
+		element *etree.Element
+		removed bool
+	}
+	kept := map[*etree.Element]bool{}
+	for _, child := range element.ChildElements() {
+		if o, ok := pairs[child]; ok {
+			kept[o] = true
+		}
+	}
+	removed := map[*etree.Element][]step{}
+	var prev *etree.Element
+	for _, child := range original.ChildElements() {
+		if kept[child] {
+			prev = child
+		} else {
+			removed[prev] = append(removed[prev], step{child, true})
+		}
+	}
+	steps := removed[nil]
+	for _, child := range element.ChildElements() {
+		steps = append(steps, step{child, false})
+		if o, ok := pairs[child]; ok {
+			steps = append(steps, removed[o]...)
+		}
+	}
+
+	// New children are inserted after the kept sibling before them, before
+	// the first kept sibling if there is none, or appended to the element if
+	// it has no kept children.
+	var added []*etree.Element
+	var first *etree.Element
+	flush := func(op, xpath string) {
+		if len(added) == 0 {
+			return
+		}
+		group := configs.CreateElement(op)
+		group.CreateAttr("xpath", xpath)
+		for _, child := range added {
+			group.AddChild(child.Copy())
+		}
+		added = nil
+	}
+	for idx := len(steps) - 1; idx >= 0; idx-- {
+		child := steps[idx].element
+		if steps[idx].removed {
+			configs.CreateElement("remove").CreateAttr("xpath", modletPath(child))
+			continue
+		}
+		o, ok := pairs[child]
+		if !ok {
+			added = append([]*etree.Element{child}, added...)
+			continue
+		}
+		flush("insertAfter", modletPath(o))
+		patchElement(child, pairs, configs)
+		first = o
+	}
+	if first != nil {
+		flush("insertBefore", modletPath(first))
+	} else {
+		flush("append", target)
+	}
+}
+
+// modletPath returns an XPath selecting the element, using the name of each
+// element along the way where it tells the element apart from its siblings.
+func modletPath(element *etree.Element) string {
+	steps := []string{}
+	for e := element; e != nil && e.Tag != ""; e = e.Parent() {
+		steps = append(steps, pathStep(e))
+	}
+	for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+		steps[i], steps[j] = steps[j], steps[i]
+	}
+	return "/" + strings.Join(steps, "/")
+}
+
+func pathStep(e *etree.Element) string {
+	parent := e.Parent()
+	if parent == nil {
+		return e.Tag
+	}
+	siblings := parent.SelectElements(e.Tag)
+	if len(siblings) == 1 {
+		return e.Tag
+	}
+	if name := e.SelectAttr("name"); name != nil && !strings.ContainsAny(name.Value, `'"`) {
+		unique := true
+		for _, s := range siblings {
+			if s != e && s.SelectAttrValue("name", "") == name.Value {
+				unique = false
+				break
+			}
+		}
+		if unique {
+			return fmt.Sprintf("%s[@name='%s']", e.Tag, name.Value)
+		}
+	}
+	for idx, s := range siblings {
+		if s == e {
+			return e.Tag + "[" + strconv.Itoa(idx+1) + "]"
+		}
+	}
+	return e.Tag
+}
@@ -0,0 +1,100 @@
+package gamedata
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/tvarney/sdtdmod/pkg/node"
+)
+
+// removeAction removes the elements it is applied to.
+type removeAction struct{}
+
+func (removeAction) Apply(element *etree.Element, r node.Reporter) bool {
+	element.Parent().RemoveChild(element)
+	return true
+}
+
+func (removeAction) Serialize() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+func TestExportModlet(t *testing.T) {
+	doc := testDoc(t, `<items>
+	<item name="a"><property name="Tags" value="t"/></item>
+	<item name="b"><property name="Old" value="1"/><property name="Tags" value="u"/></item>
+	<item name="b"/>
+</items>`)
+	doc.Name = "items.xml"
+	tree, tbl, err := loadLocalization([]byte("Key,english\r\nkeep,Keep\r\nchange,Change\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc := &Document{Name: LocalizationName, Tree: tree, table: tbl}
+
+	nodes := []*node.Node{{
+		Match:   &node.AttrMatch{Attribute: "name", Value: "a"},
+		Actions: []node.Action{&node.CloneElement{Set: map[string]string{"name": "a2"}}},
+	}, {
+		Match:   &node.AttrMatch{Attribute: "name", Value: "Old"},
+		Actions: []node.Action{removeAction{}},
+	}, {
+		Match: &node.AttrMatch{Attribute: "name", Value: "Tags"},
+		Actions: []node.Action{
+			&node.AppendText{Attribute: "value", Value: ",x"},
+			&node.InsertAttr{Attribute: "extra", Value: "1"},
+		},
+	}, {
+		Match:   &node.AttrMatch{Attribute: "Key", Value: "change"},
+		Actions: []node.Action{&node.AppendText{Attribute: "english", Value: "d"}},
+	}}
+	docs := []*Document{doc, loc}
+	m, err := ExportModlet(nodes, docs, "Test", &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := string(m.Files["Config/items.xml"])
+	for _, want := range []string{
+		`<set xpath="/items/item[2]/property[@name='Tags']/@value">u,x</set>`,
+		`<setattribute xpath="/items/item[2]/property[@name='Tags']" name="extra">1</setattribute>`,
+		`<remove xpath="/items/item[2]/property[@name='Old']"/>`,
+		`<insertAfter xpath="/items/item[@name='a']">`,
+		`<item name="a2">`,
+		`<set xpath="/items/item[@name='a']/property/@value">t,x</set>`,
+	} {
+		if !strings.Contains(items, want) {
+			t.Errorf("items.xml does not contain %s:\n%s", want, items)
+		}
+	}
+	// Patches of later elements come first, so positions are unchanged by
+	// the elements inserted before them.
+	if strings.Index(items, "item[2]") > strings.Index(items, "insertAfter") {
+		t.Errorf("item[2] is patched after an element is inserted before it:\n%s", items)
+	}
+
+	if got, want := string(m.Files["Config/Localization.txt"]), "Key,english\r\nchange,Changed\r\n"; got != want {
+		t.Errorf("Localization.txt is %q, expected %q", got, want)
+	}
+	if _, ok := m.Files["ModInfo.xml"]; !ok {
+		t.Errorf("no ModInfo.xml in %v", m.Files)
+	}
+
+	// The documents themselves are left alone.
+	if data, _ := doc.Bytes(); strings.Contains(string(data), "a2") {
+		t.Errorf("the document was changed:\n%s", data)
+	}
+}
+
+func TestExportModletUnchanged(t *testing.T) {
+	doc := testDoc(t, `<items><item name="a"/></items>`)
+	m, err := ExportModlet(nil, []*Document{doc}, "Test", &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 1 {
+		t.Errorf("expected only ModInfo.xml, got %d files", len(m.Files))
+	}
+}
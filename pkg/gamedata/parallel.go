@@ -0,0 +1,114 @@
+package gamedata
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sync"
+
+	"github.com/tvarney/sdtdmod/pkg/node"
+)
+
+// ForEach calls work for every index from 0 up to count using at most jobs
+// goroutines, handing out indices in order.
+//
+// As soon as work has returned for an index and every index before it, done
+// is called for it on the calling goroutine, so results may be used in order
+// while later indices are still being worked on. If done returns false, no
+// further work is started and ForEach returns false once the work already
+// started has finished.
+func ForEach(count, jobs int, work func(idx int), done func(idx int) bool) bool {
+	if jobs < 1 {
+		jobs = 1
+	}
+	finished := make([]chan struct{}, count)
+	for idx := range finished {
+		finished[idx] = make(chan struct{})
+	}
+	next := make(chan int)
+	stop := make(chan struct{})
+	go func() {
+		defer close(next)
+		for idx := 0; idx < count; idx++ {
+			select {
+			case next <- idx:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	wg := sync.WaitGroup{}
+	for w := 0; w < jobs && w < count; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range next {
+				work(idx)
+				close(finished[idx])
+			}
+		}()
+	}
+
+	ok := true
+	for idx := 0; idx < count; idx++ {
+		<-finished[idx]
+		if !done(idx) {
+			ok = false
+			break
+		}
+	}
+	close(stop)
+	wg.Wait()
+	return ok
+}
+
+// LoadDirJobs reads every file found under the given directory like
+// LoadDir, parsing up to jobs files at once.
+func LoadDirJobs(dir string, jobs int) ([]*Document, error) {
+	paths := []string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && IsDataFile(path) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]*Document, len(paths))
+	errs := make([]error, len(paths))
+	ForEach(len(paths), jobs, func(idx int) {
+		docs[idx], errs[idx] = LoadFile(paths[idx])
+	}, func(idx int) bool {
+		err = errs[idx]
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for idx, doc := range docs {
+		name, err := filepath.Rel(dir, paths[idx])
+		if err != nil {
+			return nil, err
+		}
+		doc.Name = filepath.ToSlash(name)
+	}
+	return docs, nil
+}
+
+// QueryJobs returns every element of the documents which matches like Query,
+// searching up to jobs documents at once.
+func QueryJobs(m node.Match, docs []*Document, jobs int) []QueryResult {
+	found := make([][]QueryResult, len(docs))
+	results := []QueryResult{}
+	ForEach(len(docs), jobs, func(idx int) {
+		found[idx] = Query(m, docs[idx:idx+1])
+	}, func(idx int) bool {
+		results = append(results, found[idx]...)
+		return true
+	})
+	return results
+}
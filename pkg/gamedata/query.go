@@ -0,0 +1,140 @@
+package gamedata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/beevik/etree"
+	"github.com/tvarney/sdtdmod/pkg/node"
+)
+
+// QueryResult is an element selected by a query.
+type QueryResult struct {
+	Document *Document
+	Element  *etree.Element
+}
+
+// Query returns every element of the documents which matches, in document
+// order. A nil match selects every element.
+func Query(m node.Match, docs []*Document) []QueryResult {
+	results := []QueryResult{}
+	for _, doc := range docs {
+		root := doc.Tree.Root()
+		if root == nil {
+			continue
+		}
+		results = queryElement(m, doc, root, results)
+	}
+	return results
+}
+
+func queryElement(m node.Match, doc *Document, element *etree.Element, results []QueryResult) []QueryResult {
+	if m == nil || m.Check(element) {
+		results = append(results, QueryResult{Document: doc, Element: element})
+	}
+	for _, child := range element.ChildElements() {
+		results = queryElement(m, doc, child, results)
+	}
+	return results
+}
+
+// ancestors returns up to count ancestors of the element, outermost first.
+func ancestors(element *etree.Element, count int) []*etree.Element {
+	list := []*etree.Element{}
+	for e := element.Parent(); e != nil && e.Tag != "" && len(list) < count; e = e.Parent() {
+		list = append([]*etree.Element{e}, list...)
+	}
+	return list
+}
+
+// formatAttrs returns the attributes of the element as they are written in
+// XML.
+func formatAttrs(element *etree.Element) string {
+	parts := make([]string, 0, len(element.Attr))
+	for _, attr := range element.Attr {
+		parts = append(parts, fmt.Sprintf("%s=%q", attr.FullKey(), attr.Value))
+	}
+	return strings.Join(parts, " ")
+}
+
+// WriteQueryTable writes one row per result with its file, XPath, and
+// attributes.
+//
+// Each result is preceded by up to context of its ancestors, indented to
+// show their depth.
+func WriteQueryTable(w io.Writer, results []QueryResult, context int) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "FILE\tXPATH\tATTRIBUTES\n")
+	for _, r := range results {
+		parents := ancestors(r.Element, context)
+		for depth, e := range parents {
+			fmt.Fprintf(tw, "%s\t%s%s\t%s\n", r.Document.Name, strings.Repeat("  ", depth), XPath(e), formatAttrs(e))
+		}
+		fmt.Fprintf(tw, "%s\t%s%s\t%s\n", r.Document.Name, strings.Repeat("  ", len(parents)), XPath(r.Element), formatAttrs(r.Element))
+	}
+	return tw.Flush()
+}
+
+// WriteQueryXML writes each result as an XML fragment preceded by a comment
+// giving its file and XPath.
+//
+// If context is set, the fragment is that of the ancestor context levels
+// above the result instead.
+func WriteQueryXML(w io.Writer, results []QueryResult, context int) error {
+	for _, r := range results {
+		e := r.Element
+		if parents := ancestors(r.Element, context); len(parents) > 0 {
+			e = parents[0]
+		}
+		doc := etree.NewDocument()
+		doc.SetRoot(e.Copy())
+		doc.Indent(2)
+		fmt.Fprintf(w, "<!-- %s:%s -->\n", r.Document.Name, XPath(r.Element))
+		if _, err := doc.WriteTo(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteQueryJSON writes each result as a JSON object on its own line.
+//
+// If context is set, each object lists up to that many ancestors, outermost
+// first.
+func WriteQueryJSON(w io.Writer, results []QueryResult, context int) error {
+	enc := json.NewEncoder(w)
+	for _, r := range results {
+		line := map[string]interface{}{
+			"file":  r.Document.Name,
+			"xpath": XPath(r.Element),
+			"tag":   r.Element.Tag,
+			"attrs": attrMap(r.Element),
+		}
+		if context > 0 {
+			parents := []map[string]interface{}{}
+			for _, e := range ancestors(r.Element, context) {
+				parents = append(parents, map[string]interface{}{
+					"xpath": XPath(e),
+					"tag":   e.Tag,
+					"attrs": attrMap(e),
+				})
+			}
+			line["context"] = parents
+		}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func attrMap(element *etree.Element) map[string]string {
+	m := make(map[string]string, len(element.Attr))
+	for _, attr := range element.Attr {
+		m[attr.FullKey()] = attr.Value
+	}
+	return m
+}
@@ -0,0 +1,134 @@
+package gamedata
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/beevik/etree"
+	"github.com/tvarney/sdtdmod/pkg/node"
+)
+
+// RecipesName is the name of the data file holding the recipes of the game.
+const RecipesName = "recipes.xml"
+
+// Ingredient is an item a recipe takes.
+type Ingredient struct {
+	Name  string
+	Count string
+}
+
+// RecipeCost is what a recipe takes and makes.
+type RecipeCost struct {
+	Ingredients []Ingredient
+	CraftTime   string
+	Count       string
+}
+
+// String describes the cost like `10 resourceWood, 2 resourceNail (30s) -> 1`.
+func (c RecipeCost) String() string {
+	parts := make([]string, 0, len(c.Ingredients))
+	for _, i := range c.Ingredients {
+		parts = append(parts, fmt.Sprintf("%s %s", i.Count, i.Name))
+	}
+	s := strings.Join(parts, ", ")
+	if c.CraftTime != "" {
+		s += fmt.Sprintf(" (%ss)", c.CraftTime)
+	}
+	return s + " -> " + c.Count
+}
+
+func (c RecipeCost) equal(o RecipeCost) bool {
+	if c.CraftTime != o.CraftTime || c.Count != o.Count || len(c.Ingredients) != len(o.Ingredients) {
+		return false
+	}
+	for idx := range c.Ingredients {
+		if c.Ingredients[idx] != o.Ingredients[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+func recipeCost(recipe *etree.Element) RecipeCost {
+	c := RecipeCost{
+		CraftTime: recipe.SelectAttrValue(node.RecipeTime, ""),
+		Count:     recipe.SelectAttrValue(node.RecipeCount, "1"),
+	}
+	for _, i := range recipe.SelectElements(node.IngredientTag) {
+		c.Ingredients = append(c.Ingredients, Ingredient{
+			Name:  i.SelectAttrValue("name", ""),
+			Count: i.SelectAttrValue(node.RecipeCount, "1"),
+		})
+	}
+	return c
+}
+
+// RecipeChange is the cost of a recipe before and after the recipes were
+// changed.
+type RecipeChange struct {
+	Recipe string
+	Before RecipeCost
+	After  RecipeCost
+}
+
+// recipeCosts returns the cost of every recipe of the documents, in order.
+// Recipes sharing a name are told apart by the order they come in.
+func recipeCosts(docs []*Document) ([]string, map[string]RecipeCost) {
+	keys := []string{}
+	costs := map[string]RecipeCost{}
+	seen := map[string]int{}
+	for _, doc := range docs {
+		root := doc.Tree.Root()
+		if root == nil || !strings.EqualFold(path.Base(doc.Name), RecipesName) {
+			continue
+		}
+		for _, recipe := range root.FindElements("//" + node.RecipeTag) {
+			name := recipe.SelectAttrValue("name", "")
+			k := fmt.Sprintf("%s#%d", name, seen[name])
+			seen[name]++
+			keys = append(keys, k)
+			costs[k] = recipeCost(recipe)
+		}
+	}
+	return keys, costs
+}
+
+// CompareRecipes returns the cost of each recipe found in recipes.xml before
+// and after the documents were changed.
+//
+// Only recipes whose cost changed are returned, unless names is set, in which
+// case only the recipes with those names are returned, changed or not.
+func CompareRecipes(before, after []*Document, names []string) []RecipeChange {
+	_, old := recipeCosts(before)
+	keys, updated := recipeCosts(after)
+	changes := []RecipeChange{}
+	for _, k := range keys {
+		name := k[:strings.LastIndexByte(k, '#')]
+		c := RecipeChange{Recipe: name, Before: old[k], After: updated[k]}
+		if len(names) > 0 {
+			for _, n := range names {
+				if n == name {
+					changes = append(changes, c)
+					break
+				}
+			}
+		} else if !c.Before.equal(c.After) {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// WriteRecipeTable writes the cost of each recipe before and after it was
+// changed, one line per recipe.
+func WriteRecipeTable(w io.Writer, changes []RecipeChange) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "RECIPE\tBEFORE\tAFTER\n")
+	for _, c := range changes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Recipe, c.Before, c.After)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,90 @@
+package gamedata
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/tvarney/sdtdmod/pkg/node"
+)
+
+// Printer is a node.Reporter which writes diagnostics for a document to a
+// stream.
+//
+// Warnings are written to Stream. If Changes is set, every attribute change is
+// written to it. Other documents of the data set may be given in Documents so
+// that actions are able to read from them.
+type Printer struct {
+	Stream    io.Writer
+	Changes   io.Writer
+	Document  string
+	Documents []*Document
+}
+
+// Change writes the change along with the location of the element.
+func (p *Printer) Change(c node.Change) {
+	if p.Changes == nil {
+		return
+	}
+	fmt.Fprintf(p.Changes, "%s:%s: %s\n", p.Document, XPath(c.Element), FormatChange(c))
+}
+
+// Warn writes the warning along with the location of the element.
+func (p *Printer) Warn(element *etree.Element, err error) {
+	fmt.Fprintf(p.Stream, "warning: %s:%s: %v\n", p.Document, XPath(element), err)
+}
+
+// Resolve returns the document with the given name.
+func (p *Printer) Resolve(name string) *etree.Document {
+	for _, doc := range p.Documents {
+		if doc.Name == name {
+			return doc.Tree
+		}
+	}
+	return nil
+}
+
+var _ node.Reporter = &Printer{}
+var _ node.Resolver = &Printer{}
+
+// XPath returns the absolute path of the element.
+//
+// Unlike etree.Element.GetPath, each step includes a 1-based position when
+// the parent has more than one child with the same tag, so the path refers to
+// exactly one element.
+func XPath(element *etree.Element) string {
+	steps := []string{}
+	for e := element; e != nil && e.Tag != ""; e = e.Parent() {
+		step := e.Tag
+		if parent := e.Parent(); parent != nil {
+			siblings := parent.SelectElements(e.Tag)
+			if len(siblings) > 1 {
+				for idx, s := range siblings {
+					if s == e {
+						step += "[" + strconv.Itoa(idx+1) + "]"
+						break
+					}
+				}
+			}
+		}
+		steps = append(steps, step)
+	}
+
+	for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+		steps[i], steps[j] = steps[j], steps[i]
+	}
+	return "/" + strings.Join(steps, "/")
+}
+
+// FormatChange returns a short description of the change to an attribute.
+func FormatChange(c node.Change) string {
+	switch {
+	case c.Added:
+		return fmt.Sprintf("@%s added %q", c.Attr, c.New)
+	case c.Removed:
+		return fmt.Sprintf("@%s removed (was %q)", c.Attr, c.Old)
+	}
+	return fmt.Sprintf("@%s %q -> %q", c.Attr, c.Old, c.New)
+}
@@ -0,0 +1,474 @@
+package gamedata
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// source is the original content of a document along with where each of its
+// elements was found in it, so that the document can be written back with
+// only the parts which changed rewritten.
+type source struct {
+	data  []byte
+	root  *span
+	spans map[*etree.Element]*span
+	// eol is the line ending of the content and indent the indentation of
+	// each level, used for inserted elements.
+	eol    string
+	indent string
+}
+
+// span is where an element was found in the original content.
+type span struct {
+	name  string
+	attrs []attrSpan
+	// start and end bound the whole element. The start tag ends with the
+	// whitespace and `>` or `/>` found between close and content, and the
+	// content of the element runs from content to contentEnd.
+	start, end     int
+	close, content int
+	contentEnd     int
+	selfClosing    bool
+	children       []*span
+}
+
+// attrSpan is where an attribute was found in a start tag, starting with the
+// whitespace before its name. Value is the value as it was parsed.
+type attrSpan struct {
+	name, value string
+	quote       byte
+	start, end  int
+	valueStart  int
+}
+
+// newSource indexes the content a tree was read from. This returns nil if the
+// content could not be matched up with the tree.
+func newSource(data []byte, tree *etree.Document) *source {
+	root, err := scanSpans(data)
+	if err != nil || tree.Root() == nil {
+		return nil
+	}
+	s := &source{data: data, root: root, spans: map[*etree.Element]*span{}, eol: "\n", indent: "\t"}
+	if !s.bind(root, tree.Root()) {
+		return nil
+	}
+	if bytes.Contains(data, []byte("\r\n")) {
+		s.eol = "\r\n"
+	}
+	if len(root.children) > 0 {
+		if indent, ok := lineIndent(data[root.content:root.children[0].start]); ok && indent != "" {
+			s.indent = indent
+		}
+	}
+	return s
+}
+
+// bind records the span of the element and its descendants, checking that the
+// span holds the same element.
+func (s *source) bind(sp *span, e *etree.Element) bool {
+	children := e.ChildElements()
+	if sp.name != e.FullTag() || len(sp.attrs) != len(e.Attr) || len(sp.children) != len(children) {
+		return false
+	}
+	for idx := range sp.attrs {
+		if sp.attrs[idx].name != e.Attr[idx].FullKey() {
+			return false
+		}
+		sp.attrs[idx].value = e.Attr[idx].Value
+	}
+	s.spans[e] = sp
+	for idx, child := range children {
+		if !s.bind(sp.children[idx], child) {
+			return false
+		}
+	}
+	return true
+}
+
+// copy returns the source for a copy of the tree it was read from.
+func (s *source) copy(orig, tree *etree.Document) *source {
+	c := &source{data: s.data, root: s.root, spans: make(map[*etree.Element]*span, len(s.spans)), eol: s.eol, indent: s.indent}
+	var walk func(o, e *etree.Element)
+	walk = func(o, e *etree.Element) {
+		if sp, ok := s.spans[o]; ok {
+			c.spans[e] = sp
+		}
+		ochildren, children := o.ChildElements(), e.ChildElements()
+		for idx := range ochildren {
+			walk(ochildren[idx], children[idx])
+		}
+	}
+	if orig.Root() != nil {
+		walk(orig.Root(), tree.Root())
+	}
+	return c
+}
+
+// write returns the content of the tree, copying the original content of
+// every part of it which did not change.
+//
+// Changed attribute values are rewritten in place, and removed attributes
+// and elements are cut out along with the whitespace before them. Inserted
+// attributes are added after the others and inserted elements are indented
+// like their siblings. Only changes to elements and attributes are written;
+// this returns false if the root element was replaced.
+func (s *source) write(tree *etree.Document) ([]byte, bool) {
+	root := tree.Root()
+	if root == nil || s.spans[root] != s.root {
+		return nil, false
+	}
+	b := &bytes.Buffer{}
+	b.Grow(len(s.data))
+	b.Write(s.data[:s.root.start])
+	s.writeElement(b, root, s.root, "")
+	b.Write(s.data[s.root.end:])
+	return b.Bytes(), true
+}
+
+func (s *source) writeElement(b *bytes.Buffer, e *etree.Element, sp *span, indent string) {
+	s.writeStartTag(b, e, sp)
+	children := e.ChildElements()
+	inner := s.childIndent(sp, indent)
+	if sp.selfClosing {
+		if len(children) == 0 {
+			b.Write(s.data[sp.close:sp.content])
+			return
+		}
+		b.WriteByte('>')
+		for _, child := range children {
+			b.WriteString(s.eol + inner)
+			b.WriteString(s.serialize(child, inner))
+		}
+		fmt.Fprintf(b, "%s%s</%s>", s.eol, indent, sp.name)
+		return
+	}
+	b.Write(s.data[sp.close:sp.content])
+
+	// Each original child is preceded by the content between it and the
+	// previous child, which is dropped along with the child if it is only
+	// whitespace.
+	gap := func(idx int) []byte {
+		if idx == 0 {
+			return s.data[sp.content:sp.children[0].start]
+		}
+		return s.data[sp.children[idx-1].end:sp.children[idx].start]
+	}
+	drop := func(idx int) {
+		if g := gap(idx); len(bytes.TrimSpace(g)) > 0 {
+			b.Write(g)
+		}
+	}
+	next := 0
+	for _, child := range children {
+		cs := s.spans[child]
+		if cs != nil && cs.name != child.FullTag() {
+			cs = nil
+		}
+		idx := indexSpan(sp.children[next:], cs)
+		if idx < 0 {
+			b.WriteString(s.eol + inner)
+			b.WriteString(s.serialize(child, inner))
+			continue
+		}
+		for ; idx > 0; idx-- {
+			drop(next)
+			next++
+		}
+		b.Write(gap(next))
+		s.writeElement(b, child, sp.children[next], inner)
+		next++
+	}
+	for ; next < len(sp.children); next++ {
+		drop(next)
+	}
+	switch {
+	case len(sp.children) > 0:
+		b.Write(s.data[sp.children[len(sp.children)-1].end:sp.end])
+	case len(children) > 0:
+		if content := s.data[sp.content:sp.contentEnd]; len(bytes.TrimSpace(content)) > 0 {
+			b.Write(content)
+		}
+		b.WriteString(s.eol + indent)
+		b.Write(s.data[sp.contentEnd:sp.end])
+	default:
+		b.Write(s.data[sp.content:sp.end])
+	}
+}
+
+// writeStartTag writes the start tag of the element up to the end of its
+// last attribute.
+func (s *source) writeStartTag(b *bytes.Buffer, e *etree.Element, sp *span) {
+	if sameAttrs(e, sp) {
+		b.Write(s.data[sp.start:sp.close])
+		return
+	}
+	b.Write(s.data[sp.start : sp.start+1+len(sp.name)])
+	current := make(map[string]string, len(e.Attr))
+	for _, attr := range e.Attr {
+		current[attr.FullKey()] = attr.Value
+	}
+	seen := make(map[string]bool, len(sp.attrs))
+	for _, a := range sp.attrs {
+		seen[a.name] = true
+		value, ok := current[a.name]
+		switch {
+		case !ok:
+		case value == a.value:
+			b.Write(s.data[a.start:a.end])
+		default:
+			b.Write(s.data[a.start:a.valueStart])
+			b.WriteString(escapeAttr(value, a.quote))
+			b.WriteByte(a.quote)
+		}
+	}
+	for _, attr := range e.Attr {
+		if !seen[attr.FullKey()] {
+			fmt.Fprintf(b, ` %s="%s"`, attr.FullKey(), escapeAttr(attr.Value, '"'))
+		}
+	}
+}
+
+func sameAttrs(e *etree.Element, sp *span) bool {
+	if len(e.Attr) != len(sp.attrs) {
+		return false
+	}
+	for idx, a := range sp.attrs {
+		if e.Attr[idx].FullKey() != a.name || e.Attr[idx].Value != a.value {
+			return false
+		}
+	}
+	return true
+}
+
+func indexSpan(spans []*span, sp *span) int {
+	if sp == nil {
+		return -1
+	}
+	for idx, s := range spans {
+		if s == sp {
+			return idx
+		}
+	}
+	return -1
+}
+
+// childIndent returns the indentation of the children of an element, taken
+// from the original content if it has any.
+func (s *source) childIndent(sp *span, indent string) string {
+	if len(sp.children) > 0 {
+		if inner, ok := lineIndent(s.data[sp.content:sp.children[0].start]); ok {
+			return inner
+		}
+	}
+	return indent + s.indent
+}
+
+// lineIndent returns the text after the last line break of whitespace.
+func lineIndent(ws []byte) (string, bool) {
+	idx := bytes.LastIndexByte(ws, '\n')
+	if idx < 0 || len(bytes.TrimSpace(ws)) > 0 {
+		return "", false
+	}
+	return string(ws[idx+1:]), true
+}
+
+// serialize returns an inserted element as XML, indented to follow the given
+// indentation.
+func (s *source) serialize(e *etree.Element, indent string) string {
+	doc := etree.NewDocument()
+	doc.SetRoot(e.Copy())
+	if strings.Trim(s.indent, " ") == "" {
+		doc.Indent(len(s.indent))
+	} else {
+		doc.IndentTabs()
+	}
+	text, err := doc.WriteToString()
+	if err != nil {
+		return ""
+	}
+	text = strings.TrimRight(text, "\n")
+	return strings.ReplaceAll(text, "\n", s.eol+indent)
+}
+
+func escapeAttr(value string, quote byte) string {
+	r := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+	value = r.Replace(value)
+	if quote == '\'' {
+		return strings.ReplaceAll(value, "'", "&apos;")
+	}
+	return strings.ReplaceAll(value, `"`, "&quot;")
+}
+
+// scanSpans finds the elements of XML content.
+func scanSpans(data []byte) (*span, error) {
+	var root *span
+	stack := []*span{}
+	for i := 0; i < len(data); {
+		lt := bytes.IndexByte(data[i:], '<')
+		if lt < 0 {
+			break
+		}
+		i += lt
+		switch {
+		case bytes.HasPrefix(data[i:], []byte("<!--")):
+			end, err := skipTo(data, i+4, "-->")
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		case bytes.HasPrefix(data[i:], []byte("<![CDATA[")):
+			end, err := skipTo(data, i+9, "]]>")
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		case bytes.HasPrefix(data[i:], []byte("<?")):
+			end, err := skipTo(data, i+2, "?>")
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		case bytes.HasPrefix(data[i:], []byte("<!")):
+			end, err := skipDecl(data, i+2)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		case bytes.HasPrefix(data[i:], []byte("</")):
+			end, err := skipTo(data, i+2, ">")
+			if err != nil {
+				return nil, err
+			}
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unexpected end tag at offset %d", i)
+			}
+			sp := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			sp.contentEnd, sp.end = i, end
+			i = end
+		default:
+			sp, err := scanStartTag(data, i)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case len(stack) > 0:
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, sp)
+			case root == nil:
+				root = sp
+			default:
+				return nil, fmt.Errorf("more than one root element")
+			}
+			if !sp.selfClosing {
+				stack = append(stack, sp)
+			}
+			i = sp.content
+		}
+	}
+	if root == nil || len(stack) > 0 {
+		return nil, fmt.Errorf("incomplete document")
+	}
+	return root, nil
+}
+
+func skipTo(data []byte, i int, end string) (int, error) {
+	idx := bytes.Index(data[i:], []byte(end))
+	if idx < 0 {
+		return 0, fmt.Errorf("unterminated markup at offset %d", i)
+	}
+	return i + idx + len(end), nil
+}
+
+// skipDecl skips a declaration such as a DOCTYPE, along with any internal
+// subset in brackets.
+func skipDecl(data []byte, i int) (int, error) {
+	depth := 0
+	for ; i < len(data); i++ {
+		switch data[i] {
+		case '"', '\'':
+			idx := bytes.IndexByte(data[i+1:], data[i])
+			if idx < 0 {
+				return 0, fmt.Errorf("unterminated declaration")
+			}
+			i += idx + 1
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '>':
+			if depth == 0 {
+				return i + 1, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unterminated declaration")
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func scanName(data []byte, i int) int {
+	for i < len(data) && !isSpace(data[i]) && data[i] != '/' && data[i] != '>' && data[i] != '=' {
+		i++
+	}
+	return i
+}
+
+func scanStartTag(data []byte, start int) (*span, error) {
+	i := scanName(data, start+1)
+	sp := &span{name: string(data[start+1 : i]), start: start}
+	for {
+		ws := i
+		for i < len(data) && isSpace(data[i]) {
+			i++
+		}
+		if i >= len(data) {
+			return nil, fmt.Errorf("unterminated start tag at offset %d", start)
+		}
+		switch {
+		case data[i] == '>':
+			sp.close, sp.content = ws, i+1
+			return sp, nil
+		case data[i] == '/' && i+1 < len(data) && data[i+1] == '>':
+			sp.close, sp.content = ws, i+2
+			sp.contentEnd, sp.end = i+2, i+2
+			sp.selfClosing = true
+			return sp, nil
+		}
+
+		a := attrSpan{start: ws}
+		nameEnd := scanName(data, i)
+		if nameEnd == i {
+			return nil, fmt.Errorf("malformed start tag at offset %d", start)
+		}
+		a.name = string(data[i:nameEnd])
+		i = nameEnd
+		for i < len(data) && isSpace(data[i]) {
+			i++
+		}
+		if i >= len(data) || data[i] != '=' {
+			return nil, fmt.Errorf("malformed attribute at offset %d", i)
+		}
+		i++
+		for i < len(data) && isSpace(data[i]) {
+			i++
+		}
+		if i >= len(data) || (data[i] != '"' && data[i] != '\'') {
+			return nil, fmt.Errorf("malformed attribute at offset %d", i)
+		}
+		a.quote = data[i]
+		a.valueStart = i + 1
+		idx := bytes.IndexByte(data[a.valueStart:], a.quote)
+		if idx < 0 {
+			return nil, fmt.Errorf("unterminated attribute at offset %d", i)
+		}
+		a.end = a.valueStart + idx + 1
+		i = a.end
+		sp.attrs = append(sp.attrs, a)
+	}
+}
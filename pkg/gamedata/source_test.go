@@ -0,0 +1,152 @@
+package gamedata
+
+import (
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+func TestSourceWrite(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		edit  func(root *etree.Element)
+		want  string
+	}{
+		{
+			name:  "unchanged",
+			input: "<?xml version=\"1.0\"?>\n<items>\n\t<!-- a comment -->\n\t<item name = 'a'   value=\"1\" />\n</items>\n",
+			edit:  func(root *etree.Element) {},
+			want:  "<?xml version=\"1.0\"?>\n<items>\n\t<!-- a comment -->\n\t<item name = 'a'   value=\"1\" />\n</items>\n",
+		},
+		{
+			name:  "byte order mark",
+			input: "\ufeff<items>\n\t<item name=\"a\" value=\"1\"/>\n</items>\n",
+			edit:  func(root *etree.Element) { root.SelectElement("item").CreateAttr("value", "2") },
+			want:  "\ufeff<items>\n\t<item name=\"a\" value=\"2\"/>\n</items>\n",
+		},
+		{
+			name:  "attribute keeps its quotes",
+			input: "<items>\n\t<item name='a' value='1'/>\n</items>\n",
+			edit:  func(root *etree.Element) { root.SelectElement("item").CreateAttr("value", "it's") },
+			want:  "<items>\n\t<item name='a' value='it&apos;s'/>\n</items>\n",
+		},
+		{
+			name:  "comments and unchanged attributes are kept",
+			input: "<items>\n\t<!-- <item name=\"x\"/> -->\n\t<item  name=\"a\"\n\t\tvalue=\"1\"/>\n</items>\n",
+			edit:  func(root *etree.Element) { root.SelectElement("item").CreateAttr("value", "2") },
+			want:  "<items>\n\t<!-- <item name=\"x\"/> -->\n\t<item  name=\"a\"\n\t\tvalue=\"2\"/>\n</items>\n",
+		},
+		{
+			name:  "attribute added and removed",
+			input: "<items>\n\t<item name=\"a\" remove=\"me\" value=\"1\"/>\n</items>\n",
+			edit: func(root *etree.Element) {
+				item := root.SelectElement("item")
+				item.RemoveAttr("remove")
+				item.CreateAttr("added", "yes")
+			},
+			want: "<items>\n\t<item name=\"a\" value=\"1\" added=\"yes\"/>\n</items>\n",
+		},
+		{
+			name:  "element removed",
+			input: "<items>\n\t<item name=\"a\"/>\n\t<item name=\"b\"/>\n\t<item name=\"c\"/>\n</items>\n",
+			edit:  func(root *etree.Element) { root.RemoveChild(root.SelectElements("item")[1]) },
+			want:  "<items>\n\t<item name=\"a\"/>\n\t<item name=\"c\"/>\n</items>\n",
+		},
+		{
+			name:  "element inserted",
+			input: "<items>\n  <item name=\"a\"/>\n  <item name=\"c\"/>\n</items>\n",
+			edit: func(root *etree.Element) {
+				b := etree.NewElement("item")
+				b.CreateAttr("name", "b")
+				b.CreateElement("property").CreateAttr("value", "1")
+				root.InsertChildAt(root.SelectElements("item")[1].Index(), b)
+			},
+			want: "<items>\n  <item name=\"a\"/>\n  <item name=\"b\">\n    <property value=\"1\"/>\n  </item>\n  <item name=\"c\"/>\n</items>\n",
+		},
+		{
+			name:  "self-closing element expanded",
+			input: "<items>\n\t<item name=\"a\"/>\n</items>\n",
+			edit: func(root *etree.Element) {
+				root.SelectElement("item").CreateElement("property").CreateAttr("name", "p")
+			},
+			want: "<items>\n\t<item name=\"a\">\n\t\t<property name=\"p\"/>\n\t</item>\n</items>\n",
+		},
+		{
+			name:  "empty element gets children",
+			input: "<items>\n\t<item name=\"a\"></item>\n</items>\n",
+			edit: func(root *etree.Element) {
+				root.SelectElement("item").CreateElement("property").CreateAttr("name", "p")
+			},
+			want: "<items>\n\t<item name=\"a\">\n\t\t<property name=\"p\"/>\n\t</item>\n</items>\n",
+		},
+		{
+			name:  "line endings",
+			input: "<items>\r\n\t<item name=\"a\"/>\r\n</items>\r\n",
+			edit: func(root *etree.Element) {
+				root.CreateElement("item").CreateAttr("name", "b")
+			},
+			want: "<items>\r\n\t<item name=\"a\"/>\r\n\t<item name=\"b\"/>\r\n</items>\r\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree := etree.NewDocument()
+			if err := tree.ReadFromString(test.input); err != nil {
+				t.Fatal(err)
+			}
+			s := newSource([]byte(test.input), tree)
+			if s == nil {
+				t.Fatal("the source could not be indexed")
+			}
+			test.edit(tree.Root())
+			got, ok := s.write(tree)
+			if !ok {
+				t.Fatal("the source could not be written")
+			}
+			if string(got) != test.want {
+				t.Errorf("got\n%q\nexpected\n%q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		eol    string
+		indent string
+	}{
+		{"tabs", "<items>\n\t<item/>\n</items>", "\n", "\t"},
+		{"spaces", "<items>\n    <item/>\n</items>", "\n", "    "},
+		{"line endings", "<items>\r\n  <item/>\r\n</items>", "\r\n", "  "},
+		{"no children", "<items/>", "\n", "\t"},
+		{"doctype", "<!DOCTYPE items [<!ENTITY a \"b\">]>\n<items>\n\t<item/>\n</items>", "\n", "\t"},
+		{"cdata", "<items><![CDATA[<item/>]]><item/></items>", "\n", "\t"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree := etree.NewDocument()
+			if err := tree.ReadFromString(test.input); err != nil {
+				t.Fatal(err)
+			}
+			s := newSource([]byte(test.input), tree)
+			if s == nil {
+				t.Fatal("the source could not be indexed")
+			}
+			if s.eol != test.eol || s.indent != test.indent {
+				t.Errorf("eol %q and indent %q, expected %q and %q", s.eol, s.indent, test.eol, test.indent)
+			}
+		})
+	}
+
+	// The source does not match a tree read from other content.
+	tree := etree.NewDocument()
+	if err := tree.ReadFromString(`<items><item name="a"/></items>`); err != nil {
+		t.Fatal(err)
+	}
+	if s := newSource([]byte(`<items><item/></items>`), tree); s != nil {
+		t.Errorf("a source was indexed for a different tree")
+	}
+}
@@ -0,0 +1,184 @@
+package gamedata
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/beevik/etree"
+	"github.com/tvarney/sdtdmod/pkg/errors"
+	"github.com/tvarney/sdtdmod/pkg/node"
+)
+
+// Report is a machine readable summary of applying a configuration to the
+// game data.
+type Report struct {
+	Files   []*FileReport  `json:"files"`
+	Nodes   []*NodeReport  `json:"nodes"`
+	Changes []ChangeReport `json:"changes"`
+}
+
+// FileReport summarizes the changes to a single document.
+type FileReport struct {
+	Name     string `json:"name"`
+	Changed  bool   `json:"changed"`
+	Modified int    `json:"elements_modified"`
+
+	elements map[*etree.Element]bool
+}
+
+// NodeReport summarizes how a top-level node and its children were applied.
+//
+// Actions which were applied to a matched element without changing it,
+// including those whose condition failed, are counted as no-ops.
+type NodeReport struct {
+	Index   int    `json:"index"`
+	Source  string `json:"source,omitempty"`
+	Matched int    `json:"elements_matched"`
+	Applied int    `json:"actions_applied"`
+	NoOps   int    `json:"actions_noop"`
+}
+
+// ChangeReport is a single attribute change along with the file, element, and
+// top-level node it belongs to.
+type ChangeReport struct {
+	File    string `json:"file"`
+	XPath   string `json:"xpath"`
+	Node    int    `json:"node"`
+	Attr    string `json:"attr"`
+	Old     string `json:"old,omitempty"`
+	New     string `json:"new,omitempty"`
+	Added   bool   `json:"added,omitempty"`
+	Removed bool   `json:"removed,omitempty"`
+}
+
+// NewReport returns an empty report for the top-level nodes.
+//
+// The source of each node is given as `file:line:column` if positions knows
+// it, or as its path otherwise.
+func NewReport(nodes []*node.Node, positions *errors.Positions) *Report {
+	r := &Report{Files: []*FileReport{}, Nodes: []*NodeReport{}, Changes: []ChangeReport{}}
+	for idx, n := range nodes {
+		nr := &NodeReport{Index: idx}
+		if n.Source != nil {
+			nr.Source = n.Source.String()
+			if positions != nil {
+				if pos, ok := positions.Lookup(n.Source); ok {
+					nr.Source = fmt.Sprintf("%s:%d:%d", n.Source.Filename, pos.Line, pos.Column)
+				}
+			}
+		}
+		r.Nodes = append(r.Nodes, nr)
+	}
+	return r
+}
+
+// Merge adds the files, counts, and changes of a report for the same nodes to
+// the report.
+//
+// Documents updated at the same time are recorded in reports of their own,
+// which are then merged in order.
+func (r *Report) Merge(other *Report) {
+	r.Files = append(r.Files, other.Files...)
+	for idx, nr := range other.Nodes {
+		r.Nodes[idx].Matched += nr.Matched
+		r.Nodes[idx].Applied += nr.Applied
+		r.Nodes[idx].NoOps += nr.NoOps
+	}
+	r.Changes = append(r.Changes, other.Changes...)
+}
+
+// WriteFile writes the report as indented JSON.
+func (r *Report) WriteFile(filename string) error {
+	d, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(d, '\n'), 0644)
+}
+
+// Recorder wraps the Reporter of a document and records what is reported to
+// it in a Report.
+type Recorder struct {
+	node.Reporter
+
+	report  *Report
+	file    *FileReport
+	tops    []*node.Node
+	owner   map[*node.Node]int
+	current int
+}
+
+// NewRecorder returns a Recorder which adds the document to the report and
+// passes everything on to the given Reporter.
+func NewRecorder(report *Report, nodes []*node.Node, doc *Document, r node.Reporter) *Recorder {
+	file := &FileReport{Name: doc.Name, elements: map[*etree.Element]bool{}}
+	report.Files = append(report.Files, file)
+	rec := &Recorder{Reporter: r, report: report, file: file, tops: nodes, owner: map[*node.Node]int{}}
+	for idx, n := range nodes {
+		rec.own(n, idx)
+	}
+	return rec
+}
+
+func (r *Recorder) own(n *node.Node, idx int) {
+	r.owner[n] = idx
+	for _, child := range n.Children {
+		r.own(child, idx)
+	}
+}
+
+// Change records the change and passes it on.
+func (r *Recorder) Change(c node.Change) {
+	if !r.file.elements[c.Element] {
+		r.file.elements[c.Element] = true
+		r.file.Modified++
+	}
+	r.file.Changed = true
+	r.report.Changes = append(r.report.Changes, ChangeReport{
+		File:    r.file.Name,
+		XPath:   XPath(c.Element),
+		Node:    r.current,
+		Attr:    c.Attr,
+		Old:     c.Old,
+		New:     c.New,
+		Added:   c.Added,
+		Removed: c.Removed,
+	})
+	r.Reporter.Change(c)
+}
+
+// Matched counts the element for the node if it is a top-level node.
+func (r *Recorder) Matched(n *node.Node, element *etree.Element) {
+	idx, ok := r.owner[n]
+	if !ok || r.tops[idx] != n {
+		return
+	}
+	r.current = idx
+	r.report.Nodes[idx].Matched++
+}
+
+// Applied counts the action for the top-level node the node belongs to.
+func (r *Recorder) Applied(n *node.Node, a node.Action, element *etree.Element, changed bool) {
+	idx, ok := r.owner[n]
+	if !ok {
+		return
+	}
+	if changed {
+		r.report.Nodes[idx].Applied++
+	} else {
+		r.report.Nodes[idx].NoOps++
+	}
+}
+
+// Resolve passes the lookup on to the wrapped Reporter if it is a Resolver.
+func (r *Recorder) Resolve(name string) *etree.Document {
+	if resolver, ok := r.Reporter.(node.Resolver); ok {
+		return resolver.Resolve(name)
+	}
+	return nil
+}
+
+var _ node.Reporter = &Recorder{}
+var _ node.Tracker = &Recorder{}
+var _ node.Resolver = &Recorder{}
@@ -0,0 +1,185 @@
+package gamedata
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/tvarney/sdtdmod/pkg/node"
+)
+
+// TestResult is the outcome of running a test case.
+//
+// Failures describes each check which failed; a failed output comparison is
+// followed by a diff of the expected and actual output, one line per entry.
+// Warnings holds the warnings of actions applied by the test.
+type TestResult struct {
+	Test     *node.Test
+	Failures []string
+	Warnings []string
+}
+
+// Passed checks if every check of the test passed.
+func (r *TestResult) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// RunTest applies the nodes a test selects from the top-level nodes to its
+// input and checks the result.
+func RunTest(t *node.Test, nodes []*node.Node) *TestResult {
+	result := &TestResult{Test: t}
+	if len(t.Nodes) > 0 {
+		selected := make([]*node.Node, 0, len(t.Nodes))
+		for _, name := range t.Nodes {
+			found := false
+			for _, n := range nodes {
+				if n.Name == name {
+					selected = append(selected, n)
+					found = true
+				}
+			}
+			if !found {
+				result.Failures = append(result.Failures, fmt.Sprintf("no node named %q", name))
+			}
+		}
+		if !result.Passed() {
+			return result
+		}
+		nodes = selected
+	}
+
+	tree := etree.NewDocument()
+	if err := tree.ReadFromString(t.Input); err != nil {
+		result.Failures = append(result.Failures, fmt.Sprintf("invalid input: %v", err))
+		return result
+	}
+	Apply(nodes, &Document{Name: "input", Tree: tree}, &testReporter{result: result})
+
+	if t.Output != "" {
+		expected, err := canonicalXML(t.Output)
+		if err != nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("invalid output: %v", err))
+			return result
+		}
+		actual, err := canonicalXML(mustString(tree))
+		if err != nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("invalid result: %v", err))
+			return result
+		}
+		if expected != actual {
+			result.Failures = append(result.Failures, "output differs (-expected +actual):")
+			result.Failures = append(result.Failures, diffLines(splitLines(expected), splitLines(actual))...)
+		}
+	}
+
+	for _, e := range t.Expect {
+		path, err := etree.CompilePath(e.Path)
+		if err != nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("%s: %v", e.Path, err))
+			continue
+		}
+		element := tree.FindElementPath(path)
+		if element == nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("%s: no element found", e.Path))
+			continue
+		}
+		attr := element.SelectAttr(e.Attr)
+		switch {
+		case e.Absent && attr != nil:
+			result.Failures = append(result.Failures, fmt.Sprintf("%s: @%s is %q, expected no attribute", e.Path, e.Attr, attr.Value))
+		case !e.Absent && attr == nil:
+			result.Failures = append(result.Failures, fmt.Sprintf("%s: @%s does not exist, expected %q", e.Path, e.Attr, e.Value))
+		case !e.Absent && attr.Value != e.Value:
+			result.Failures = append(result.Failures, fmt.Sprintf("%s: @%s is %q, expected %q", e.Path, e.Attr, attr.Value, e.Value))
+		}
+	}
+	return result
+}
+
+// testReporter records the warnings of a test.
+type testReporter struct {
+	node.Discard
+	result *TestResult
+}
+
+func (r *testReporter) Warn(element *etree.Element, err error) {
+	r.result.Warnings = append(r.result.Warnings, fmt.Sprintf("%s: %v", XPath(element), err))
+}
+
+func mustString(tree *etree.Document) string {
+	s, _ := tree.WriteToString()
+	return s
+}
+
+// canonicalXML returns XML with the whitespace between elements replaced by
+// indentation and the attributes of every element sorted, so that documents
+// which only differ in those ways compare equal.
+func canonicalXML(s string) (string, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(s); err != nil {
+		return "", err
+	}
+	root := doc.Root()
+	if root == nil {
+		return "", fmt.Errorf("no root element")
+	}
+	sortAttrs(root)
+	out := etree.NewDocument()
+	out.SetRoot(root)
+	out.Indent(2)
+	return out.WriteToString()
+}
+
+func sortAttrs(element *etree.Element) {
+	sort.SliceStable(element.Attr, func(i, j int) bool {
+		return element.Attr[i].FullKey() < element.Attr[j].FullKey()
+	})
+	for _, child := range element.ChildElements() {
+		sortAttrs(child)
+	}
+}
+
+func splitLines(s string) []string {
+	return strings.Split(strings.TrimRight(s, "\n"), "\n")
+}
+
+// diffLines returns the lines of a and b prefixed with `-` if they are only in
+// a, `+` if they are only in b, and a space if they are in both.
+func diffLines(a, b []string) []string {
+	// common[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	lines := make([]string, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, "  "+a[i])
+			i++
+			j++
+		case j >= len(b) || (i < len(a) && common[i+1][j] >= common[i][j+1]):
+			lines = append(lines, "- "+a[i])
+			i++
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+	return lines
+}
@@ -0,0 +1,171 @@
+package gamedata
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/beevik/etree"
+	"github.com/tvarney/maputil/errctx"
+	"github.com/tvarney/maputil/mpath"
+	"github.com/tvarney/sdtdmod/pkg/errors"
+	"github.com/tvarney/sdtdmod/pkg/node"
+	"github.com/tvarney/sdtdmod/pkg/node/key"
+)
+
+// Validate runs the nodes against the documents without modifying them and
+// reports rules which do not fit the data.
+//
+// Nodes and conditions which match no elements, attributes which actions
+// target but which no element has, and values which a Number can't parse are
+// reported as warnings to the handler at the source path of the node or
+// action. This returns the number of problems found.
+func Validate(nodes []*node.Node, docs []*Document, handler errctx.ErrorHandler) int {
+	v := &validator{
+		matched: map[*node.Node]int{},
+		actions: map[node.Action]*actionUsage{},
+		handler: handler,
+	}
+	for _, doc := range docs {
+		if root := doc.Tree.Root(); root != nil {
+			v.visitTree(nodes, doc, root)
+		}
+	}
+	v.report(nodes)
+	return v.count
+}
+
+// actionUsage records how an action would have been applied.
+//
+// Attrs holds every attribute the action targeted, and whether any element
+// had it.
+type actionUsage struct {
+	applied int
+	attrs   map[string]bool
+	invalid int
+	example string
+}
+
+type validator struct {
+	matched map[*node.Node]int
+	actions map[node.Action]*actionUsage
+	handler errctx.ErrorHandler
+	count   int
+}
+
+func (v *validator) visitTree(nodes []*node.Node, doc *Document, element *etree.Element) {
+	for _, n := range nodes {
+		v.visit(n, doc, element)
+	}
+	for _, child := range element.ChildElements() {
+		v.visitTree(nodes, doc, child)
+	}
+}
+
+// visit mirrors node.Node.Apply without modifying the element.
+func (v *validator) visit(n *node.Node, doc *Document, element *etree.Element) {
+	if n.Match != nil && !n.Match.Check(element) {
+		return
+	}
+	v.matched[n]++
+
+	for _, child := range element.ChildElements() {
+		for _, c := range n.Children {
+			v.visit(c, doc, child)
+		}
+	}
+
+	for _, a := range n.Actions {
+		u := v.usage(a)
+		if cond := node.Condition(a); cond != nil && !cond.Check(element) {
+			continue
+		}
+		u.applied++
+
+		t, ok := a.(node.Targeted)
+		if !ok {
+			continue
+		}
+		for _, name := range t.Targets(element) {
+			attr := element.SelectAttr(name)
+			if attr == nil {
+				if _, seen := u.attrs[name]; !seen {
+					u.attrs[name] = false
+				}
+				continue
+			}
+			u.attrs[name] = true
+			if num, ok := a.(*node.Number); ok && num.Validate(attr.Value) != nil {
+				u.invalid++
+				if u.example == "" {
+					u.example = fmt.Sprintf("%q at %s:%s/@%s", attr.Value, doc.Name, XPath(element), name)
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) usage(a node.Action) *actionUsage {
+	u, ok := v.actions[a]
+	if !ok {
+		u = &actionUsage{attrs: map[string]bool{}}
+		v.actions[a] = u
+	}
+	return u
+}
+
+func (v *validator) report(nodes []*node.Node) {
+	for _, n := range nodes {
+		matched := v.matched[n]
+		if matched == 0 {
+			v.warn(n.Source, fmt.Errorf("node matches no elements"), mpath.Key(key.Match))
+			continue
+		}
+
+		for idx, a := range n.Actions {
+			u := v.usage(a)
+			if node.Condition(a) != nil && u.applied == 0 {
+				v.warn(n.Source, fmt.Errorf("condition matches none of the %d elements matched by the node", matched),
+					mpath.Key(key.Actions), mpath.Index(idx), mpath.Key(key.Cond))
+				continue
+			}
+
+			names := make([]string, 0, len(u.attrs))
+			for name, exists := range u.attrs {
+				if !exists {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				v.warn(n.Source, fmt.Errorf("attribute %q does not exist on any of the %d elements the action applies to", name, u.applied),
+					mpath.Key(key.Actions), mpath.Index(idx))
+			}
+			if u.invalid > 0 {
+				v.warn(n.Source, fmt.Errorf("%d values are not numbers, such as %s", u.invalid, u.example),
+					mpath.Key(key.Actions), mpath.Index(idx))
+			}
+		}
+		v.report(n.Children)
+	}
+}
+
+// warn reports a problem at the given elements below the source path of a
+// node.
+func (v *validator) warn(source *mpath.Path, err error, elements ...mpath.Element) {
+	v.count++
+	if v.handler == nil {
+		return
+	}
+
+	var p *mpath.Path
+	if source != nil {
+		p = source.Copy()
+		p.Filename = source.Filename
+	} else {
+		p = mpath.New(mpath.DotNotation{})
+	}
+	for _, e := range elements {
+		p.Add(e)
+	}
+	v.handler.Add(p, &errors.Diagnostic{Severity: errors.SeverityWarning, Err: err})
+}
@@ -0,0 +1,253 @@
+// Package journal records the changes made to a game data directory by each
+// run of apply so that they can be reverted.
+package journal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DirName is the name of the directory the journal is kept in when it is kept
+// in the data directory.
+const DirName = ".sdtdmod"
+
+// backupExt is added to the names of backed up files so that they are not
+// loaded as game data when the journal is kept in the data directory.
+const backupExt = ".orig"
+
+// Run is the record of a single run of apply.
+type Run struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	// Config is the name of the root config file, and ConfigHash the hash of
+	// every config file which was read.
+	Config     string `json:"config"`
+	ConfigHash string `json:"config_hash"`
+	Files      []File `json:"files"`
+
+	backups map[string][]byte
+}
+
+// File is the record of a single file written by a run, with the hash of its
+// content before and after the run.
+type File struct {
+	Name   string `json:"name"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// NewRun returns an empty record of a run of apply with the given config
+// files.
+func NewRun(config []string) (*Run, error) {
+	h := sha256.New()
+	for _, name := range config {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(name), len(data))
+		h.Write(data)
+	}
+	run := &Run{Time: time.Now().UTC(), ConfigHash: hex.EncodeToString(h.Sum(nil)), backups: map[string][]byte{}}
+	if len(config) > 0 {
+		run.Config = config[0]
+	}
+	return run, nil
+}
+
+// Add records that the run replaced the content of the named file.
+func (r *Run) Add(name string, before, after []byte) {
+	r.Files = append(r.Files, File{Name: name, Before: Hash(before), After: Hash(after)})
+	r.backups[name] = before
+}
+
+// Hash returns the hash of file content as it is kept in the journal.
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Journal is the record of every run of apply on a data directory which has
+// not been reverted.
+//
+// Each run is kept in its own directory, holding the record of the run and a
+// copy of every file as it was before the run.
+type Journal struct {
+	Dir string
+}
+
+// Record adds the run to the journal, giving it an ID.
+//
+// This must be done before the files of the run are written, so that a run
+// which fails part way can still be reverted.
+func (j *Journal) Record(run *Run) error {
+	id := run.Time.Format("20060102T150405Z")
+	for n := 2; ; n++ {
+		if _, err := os.Stat(j.runDir(id)); os.IsNotExist(err) {
+			break
+		}
+		id = run.Time.Format("20060102T150405Z") + "-" + strconv.Itoa(n)
+	}
+	run.ID = id
+
+	dir := j.runDir(id)
+	for _, f := range run.Files {
+		path := filepath.Join(dir, "files", filepath.FromSlash(f.Name)+backupExt)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, run.backups[f.Name], 0644); err != nil {
+			return err
+		}
+	}
+	d, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "run.json"), append(d, '\n'), 0644)
+}
+
+// Runs returns every run in the journal, oldest first.
+func (j *Journal) Runs() ([]*Run, error) {
+	entries, err := os.ReadDir(filepath.Join(j.Dir, "runs"))
+	if os.IsNotExist(err) {
+		return []*Run{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	runs := []*Run{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(j.runDir(entry.Name()), "run.json"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		run := &Run{}
+		if err := json.Unmarshal(data, run); err != nil {
+			return nil, fmt.Errorf("run %s: %v", entry.Name(), err)
+		}
+		runs = append(runs, run)
+	}
+	sort.SliceStable(runs, func(i, k int) bool {
+		if !runs[i].Time.Equal(runs[k].Time) {
+			return runs[i].Time.Before(runs[k].Time)
+		}
+		return runs[i].ID < runs[k].ID
+	})
+	return runs, nil
+}
+
+func (j *Journal) runDir(id string) string {
+	return filepath.Join(j.Dir, "runs", id)
+}
+
+// ModifiedError is returned by Revert when files have changed since the runs
+// which would be reverted wrote them.
+type ModifiedError struct {
+	Files []string
+}
+
+func (e *ModifiedError) Error() string {
+	return fmt.Sprintf("changed since they were written: %s", strings.Join(e.Files, ", "))
+}
+
+// Revert restores the files of the data directory to how they were before the
+// run with the given ID, undoing it and every later run. If the ID is empty,
+// only the last run is undone. The reverted runs are removed from the journal
+// and returned, most recent first.
+//
+// Unless force is set, nothing is restored if any file is not as the run which
+// last wrote it left it.
+func (j *Journal) Revert(dir, id string, force bool) ([]*Run, error) {
+	runs, err := j.Runs()
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("there are no runs to revert")
+	}
+	start := len(runs) - 1
+	if id != "" {
+		start = -1
+		for idx, run := range runs {
+			if run.ID == id {
+				start = idx
+			}
+		}
+		if start < 0 {
+			return nil, fmt.Errorf("no run with the ID %q", id)
+		}
+	}
+	reverted := make([]*Run, 0, len(runs)-start)
+	for idx := len(runs) - 1; idx >= start; idx-- {
+		reverted = append(reverted, runs[idx])
+	}
+
+	if !force {
+		if err := j.check(dir, reverted); err != nil {
+			return nil, err
+		}
+	}
+	for _, run := range reverted {
+		for _, f := range run.Files {
+			backup := filepath.Join(j.runDir(run.ID), "files", filepath.FromSlash(f.Name)+backupExt)
+			data, err := os.ReadFile(backup)
+			if err != nil {
+				return nil, err
+			}
+			if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(f.Name)), data, 0644); err != nil {
+				return nil, err
+			}
+		}
+		if err := os.RemoveAll(j.runDir(run.ID)); err != nil {
+			return nil, err
+		}
+	}
+	return reverted, nil
+}
+
+// check makes sure that every file of the runs, most recent first, holds what
+// the run left in it when the runs after it are undone.
+func (j *Journal) check(dir string, runs []*Run) error {
+	current := map[string]string{}
+	modified := []string{}
+	for _, run := range runs {
+		for _, f := range run.Files {
+			hash, ok := current[f.Name]
+			if !ok {
+				data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(f.Name)))
+				if err != nil && !os.IsNotExist(err) {
+					return err
+				}
+				if err == nil {
+					hash = Hash(data)
+				}
+			}
+			if hash != f.After {
+				modified = append(modified, f.Name)
+			}
+			current[f.Name] = f.Before
+		}
+	}
+	if len(modified) > 0 {
+		return &ModifiedError{Files: modified}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package journal
+
+import (
+	goerrors "errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testApply writes content to the files of the data directory the way apply
+// does, recording the run in the journal first.
+func testApply(t *testing.T, j *Journal, dir string, at time.Time, files map[string]string) *Run {
+	t.Helper()
+	run, err := NewRun(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run.Time = at
+	for name, content := range files {
+		before, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		run.Add(name, before, []byte(content))
+	}
+	if err := j.Record(run); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		testWrite(t, dir, name, content)
+	}
+	return run
+}
+
+func testWrite(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testRead(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func testJournal(t *testing.T) (*Journal, string) {
+	dir := t.TempDir()
+	testWrite(t, dir, "items.xml", "items 0")
+	testWrite(t, dir, "blocks.xml", "blocks 0")
+	return &Journal{Dir: filepath.Join(dir, DirName)}, dir
+}
+
+var start = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func TestRevertLast(t *testing.T) {
+	j, dir := testJournal(t)
+	run := testApply(t, j, dir, start, map[string]string{"items.xml": "items 1"})
+
+	runs, err := j.Runs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].ID != run.ID || len(runs[0].Files) != 1 {
+		t.Fatalf("the journal holds %v, expected the run %s", runs, run.ID)
+	}
+
+	reverted, err := j.Revert(dir, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 1 || reverted[0].ID != run.ID {
+		t.Errorf("reverted %v, expected the run %s", reverted, run.ID)
+	}
+	if got := testRead(t, dir, "items.xml"); got != "items 0" {
+		t.Errorf("items.xml holds %q after reverting", got)
+	}
+	if runs, _ := j.Runs(); len(runs) != 0 {
+		t.Errorf("the journal still holds %d runs", len(runs))
+	}
+	if _, err := j.Revert(dir, "", false); err == nil {
+		t.Errorf("reverting an empty journal did not fail")
+	}
+}
+
+func TestRevertTo(t *testing.T) {
+	j, dir := testJournal(t)
+	testApply(t, j, dir, start, map[string]string{"items.xml": "items 1"})
+	second := testApply(t, j, dir, start.Add(time.Minute), map[string]string{"items.xml": "items 2", "blocks.xml": "blocks 2"})
+	testApply(t, j, dir, start.Add(2*time.Minute), map[string]string{"items.xml": "items 3"})
+
+	if _, err := j.Revert(dir, "missing", false); err == nil {
+		t.Errorf("reverting to a missing run did not fail")
+	}
+	reverted, err := j.Revert(dir, second.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 2 || reverted[1].ID != second.ID {
+		t.Errorf("reverted %d runs, expected the last two most recent first", len(reverted))
+	}
+	if got := testRead(t, dir, "items.xml"); got != "items 1" {
+		t.Errorf("items.xml holds %q, expected it as the first run left it", got)
+	}
+	if got := testRead(t, dir, "blocks.xml"); got != "blocks 0" {
+		t.Errorf("blocks.xml holds %q, expected the original", got)
+	}
+	if runs, _ := j.Runs(); len(runs) != 1 {
+		t.Errorf("the journal holds %d runs, expected 1", len(runs))
+	}
+}
+
+func TestRevertModified(t *testing.T) {
+	j, dir := testJournal(t)
+	testApply(t, j, dir, start, map[string]string{"items.xml": "items 1"})
+	first := testApply(t, j, dir, start, map[string]string{"blocks.xml": "blocks 1"})
+	testApply(t, j, dir, start.Add(time.Minute), map[string]string{"items.xml": "items 2"})
+	testWrite(t, dir, "blocks.xml", "edited")
+
+	// The file was changed after the run which wrote it, although a later
+	// run wrote another file.
+	_, err := j.Revert(dir, first.ID, false)
+	var merr *ModifiedError
+	if !goerrors.As(err, &merr) || len(merr.Files) != 1 || merr.Files[0] != "blocks.xml" {
+		t.Fatalf("got %v, expected blocks.xml to be reported as modified", err)
+	}
+	if got := testRead(t, dir, "items.xml"); got != "items 2" {
+		t.Errorf("items.xml was restored to %q although reverting failed", got)
+	}
+	if runs, _ := j.Runs(); len(runs) != 3 {
+		t.Errorf("the journal holds %d runs, expected 3", len(runs))
+	}
+
+	if _, err := j.Revert(dir, first.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := testRead(t, dir, "blocks.xml"); got != "blocks 0" {
+		t.Errorf("blocks.xml holds %q after forcing the revert", got)
+	}
+	if got := testRead(t, dir, "items.xml"); got != "items 1" {
+		t.Errorf("items.xml holds %q after forcing the revert", got)
+	}
+}
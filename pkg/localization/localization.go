@@ -0,0 +1,215 @@
+// Package localization reads and writes the Localization.txt file of the game.
+//
+// The file is a CSV table with a header row naming the columns: the key of
+// each entry, a few columns describing it, and one column per language.
+// Rows are written back exactly as they were read unless their values change,
+// and changed rows keep the quoting of each of their fields.
+package localization
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// KeyColumn is the name of the column holding the key of each entry.
+const KeyColumn = "Key"
+
+// Table is the content of a localization file.
+type Table struct {
+	Columns []string
+	Rows    []*Row
+
+	prefix []byte
+	header string
+	eol    string
+}
+
+// Row is a single row of a table, as it was read.
+type Row struct {
+	values []string
+	quoted []bool
+	raw    string
+	eol    string
+}
+
+// Values returns a copy of the values of the row.
+func (r *Row) Values() []string {
+	return append([]string{}, r.values...)
+}
+
+// Edit is a row to be written: the values of the row and the row of the table
+// it was read from, if any.
+type Edit struct {
+	Row    *Row
+	Values []string
+}
+
+// Parse reads a table.
+//
+// A byte order mark and the line endings of the file are kept. Fields may be
+// quoted, in which case they may hold commas, line breaks, and doubled quotes.
+func Parse(data []byte) (*Table, error) {
+	t := &Table{eol: "\n"}
+	if bytes.HasPrefix(data, []byte("\xef\xbb\xbf")) {
+		t.prefix, data = data[:3], data[3:]
+	}
+	if bytes.Contains(data, []byte("\r\n")) {
+		t.eol = "\r\n"
+	}
+
+	s := string(data)
+	line := 1
+	for len(s) > 0 {
+		row, n, err := parseRow(s)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		line += strings.Count(s[:n], "\n")
+		s = s[n:]
+		if t.Columns == nil {
+			t.Columns = row.values
+			t.header = row.raw + row.eol
+			continue
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	if t.Columns == nil {
+		return nil, fmt.Errorf("no header row")
+	}
+	return t, nil
+}
+
+// parseRow reads the row at the start of s, returning it and the length of
+// its text including its line ending.
+func parseRow(s string) (*Row, int, error) {
+	row := &Row{}
+	i := 0
+	for {
+		value := strings.Builder{}
+		quoted := i < len(s) && s[i] == '"'
+		if quoted {
+			i++
+			for {
+				end := strings.IndexByte(s[i:], '"')
+				if end < 0 {
+					return nil, 0, fmt.Errorf("unterminated quoted field")
+				}
+				value.WriteString(s[i : i+end])
+				i += end + 1
+				if i < len(s) && s[i] == '"' {
+					value.WriteByte('"')
+					i++
+					continue
+				}
+				break
+			}
+		} else {
+			end := strings.IndexAny(s[i:], ",\r\n")
+			if end < 0 {
+				end = len(s) - i
+			}
+			value.WriteString(s[i : i+end])
+			i += end
+		}
+		row.values = append(row.values, value.String())
+		row.quoted = append(row.quoted, quoted)
+
+		switch {
+		case i < len(s) && s[i] == ',':
+			i++
+		case i >= len(s):
+			row.raw = s
+			return row, i, nil
+		case strings.HasPrefix(s[i:], "\r\n"):
+			row.raw, row.eol = s[:i], "\r\n"
+			return row, i + 2, nil
+		case s[i] == '\n':
+			row.raw, row.eol = s[:i], "\n"
+			return row, i + 1, nil
+		default:
+			return nil, 0, fmt.Errorf("unexpected %q after quoted field", s[i])
+		}
+	}
+}
+
+// Column returns the position of the named column, or -1 if there is none.
+func (t *Table) Column(name string) int {
+	for idx, col := range t.Columns {
+		if col == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+// Write returns the content of a file with the header of the table followed
+// by the given rows.
+//
+// A row read from the table whose values have not changed is written exactly
+// as it was read. Other rows have their fields quoted if the field was quoted
+// before or if the value requires it, and trailing empty fields are only
+// written up to the number the row had before.
+func (t *Table) Write(rows []Edit) []byte {
+	b := &bytes.Buffer{}
+	b.Write(t.prefix)
+	b.WriteString(t.header)
+	if len(rows) > 0 && !strings.HasSuffix(t.header, "\n") {
+		b.WriteString(t.eol)
+	}
+	for idx, edit := range rows {
+		eol := t.eol
+		if edit.Row != nil {
+			eol = edit.Row.eol
+		}
+		if eol == "" && idx < len(rows)-1 {
+			eol = t.eol
+		}
+
+		if edit.Row != nil && equal(edit.Row.values, edit.Values) {
+			b.WriteString(edit.Row.raw)
+			b.WriteString(eol)
+			continue
+		}
+		values := edit.Values
+		count := len(values)
+		for count > 0 && values[count-1] == "" && (edit.Row == nil || count > len(edit.Row.values)) {
+			count--
+		}
+		for col, value := range values[:count] {
+			if col > 0 {
+				b.WriteByte(',')
+			}
+			quoted := edit.Row != nil && col < len(edit.Row.quoted) && edit.Row.quoted[col]
+			if quoted || strings.ContainsAny(value, ",\"\r\n") {
+				b.WriteByte('"')
+				b.WriteString(strings.ReplaceAll(value, `"`, `""`))
+				b.WriteByte('"')
+			} else {
+				b.WriteString(value)
+			}
+		}
+		b.WriteString(eol)
+	}
+	return b.Bytes()
+}
+
+func equal(a, b []string) bool {
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+	for idx := 0; idx < n; idx++ {
+		var x, y string
+		if idx < len(a) {
+			x = a[idx]
+		}
+		if idx < len(b) {
+			y = b[idx]
+		}
+		if x != y {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,543 @@
+// Package loot models the loot groups and containers of loot.xml.
+//
+// A loot container or group is a list of entries, each naming either an item
+// or another group. When a list is looted, a number of entries is picked from
+// it at random, each entry being picked with a chance proportional to its
+// `prob` weight; entries with `force_prob` set, and every entry of a list
+// whose count is `all`, are instead rolled on their own with `prob` as their
+// chance. A group entry loots the group it names in turn. An entry may take
+// its weight from a `lootprobtemplate` for the loot level being modelled.
+//
+// The chances computed here treat each pick as independent, which is how the
+// game picks entries, and treat the different ways a list may yield an item
+// as independent, which they only nearly are.
+package loot
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Tags and attributes of loot.xml.
+const (
+	TagContainer        = "lootcontainer"
+	TagGroup            = "lootgroup"
+	TagItem             = "item"
+	TagProbTemplate     = "lootprobtemplate"
+	TagQualityTemplate  = "lootqualitytemplate"
+	TagTemplateLoot     = "loot"
+	AttrName            = "name"
+	AttrID              = "id"
+	AttrGroup           = "group"
+	AttrCount           = "count"
+	AttrProb            = "prob"
+	AttrForceProb       = "force_prob"
+	AttrLevel           = "level"
+	AttrProbTemplate    = "loot_prob_template"
+	AttrQualityTemplate = "loot_quality_template"
+	CountAll            = "all"
+)
+
+// Entry is a single entry of a loot list.
+type Entry struct {
+	Element *etree.Element
+	// Item is the name of the item the entry yields, if it names one.
+	Item string
+	// Group is the name of the group the entry loots, if it names one.
+	Group string
+	// Prob is the weight of the entry, or its chance if it is rolled on its
+	// own. It is only used if ProbTemplate is not set.
+	Prob            float64
+	ProbTemplate    string
+	QualityTemplate string
+	Force           bool
+}
+
+// List is a loot container or group.
+type List struct {
+	Element   *etree.Element
+	Name      string
+	Container bool
+	// MinCount and MaxCount are the range of the number of entries picked.
+	MinCount int
+	MaxCount int
+	// All is set if every entry is rolled on its own.
+	All             bool
+	QualityTemplate string
+	Entries         []*Entry
+}
+
+// levelProb is the weight a prob template gives entries for a range of loot
+// levels.
+type levelProb struct {
+	min, max float64
+	prob     float64
+}
+
+// Model is the loot of a loot.xml document.
+type Model struct {
+	Containers map[string]*List
+	Groups     map[string]*List
+	// Level is the loot level used to look up prob templates.
+	Level float64
+
+	probTemplates    map[string][]levelProb
+	qualityTemplates map[string]*etree.Element
+}
+
+// New returns the model of the loot lists and templates found under the
+// root element.
+//
+// References which can not be resolved and values which can not be read are
+// returned as errors; the model is still usable, with such entries never
+// yielding anything.
+func New(root *etree.Element, level float64) (*Model, []error) {
+	m := newModel(level)
+	errs := []error{}
+	walk(root, func(e *etree.Element) {
+		switch e.Tag {
+		case TagContainer, TagGroup:
+			l, err := ParseList(e)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if l.Container {
+				m.Containers[l.Name] = l
+			} else {
+				m.Groups[l.Name] = l
+			}
+		default:
+			if err := m.addTemplate(e); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	})
+
+	for _, l := range m.lists() {
+		if l.QualityTemplate != "" && m.qualityTemplates[l.QualityTemplate] == nil {
+			errs = append(errs, fmt.Errorf("%s %q: unknown quality template %q", l.Element.Tag, l.Name, l.QualityTemplate))
+		}
+		for _, e := range l.Entries {
+			switch {
+			case e.Group != "" && m.Groups[e.Group] == nil:
+				errs = append(errs, fmt.Errorf("%s %q: unknown group %q", l.Element.Tag, l.Name, e.Group))
+			case e.ProbTemplate != "" && m.probTemplates[e.ProbTemplate] == nil:
+				errs = append(errs, fmt.Errorf("%s %q: unknown prob template %q", l.Element.Tag, l.Name, e.ProbTemplate))
+			case e.QualityTemplate != "" && m.qualityTemplates[e.QualityTemplate] == nil:
+				errs = append(errs, fmt.Errorf("%s %q: unknown quality template %q", l.Element.Tag, l.Name, e.QualityTemplate))
+			}
+		}
+	}
+	return m, errs
+}
+
+// Templates returns a model holding only the prob and quality templates found
+// under the root element. It is used to look up the weights of lists parsed
+// on their own with ParseList, which is cheaper than building the whole model
+// when only a few lists are needed.
+func Templates(root *etree.Element, level float64) (*Model, []error) {
+	m := newModel(level)
+	errs := []error{}
+	walk(root, func(e *etree.Element) {
+		if err := m.addTemplate(e); err != nil {
+			errs = append(errs, err)
+		}
+	})
+	return m, errs
+}
+
+func newModel(level float64) *Model {
+	return &Model{
+		Containers:       map[string]*List{},
+		Groups:           map[string]*List{},
+		Level:            level,
+		probTemplates:    map[string][]levelProb{},
+		qualityTemplates: map[string]*etree.Element{},
+	}
+}
+
+// addTemplate adds the element to the model if it is a template.
+func (m *Model) addTemplate(e *etree.Element) error {
+	switch e.Tag {
+	case TagProbTemplate:
+		levels, err := parseProbTemplate(e)
+		m.probTemplates[e.SelectAttrValue(AttrName, "")] = levels
+		return err
+	case TagQualityTemplate:
+		m.qualityTemplates[e.SelectAttrValue(AttrName, "")] = e
+	}
+	return nil
+}
+
+func walk(element *etree.Element, f func(*etree.Element)) {
+	f(element)
+	for _, child := range element.ChildElements() {
+		walk(child, f)
+	}
+}
+
+// lists returns every list of the model, containers first, in order of name.
+func (m *Model) lists() []*List {
+	lists := make([]*List, 0, len(m.Containers)+len(m.Groups))
+	for _, set := range []map[string]*List{m.Containers, m.Groups} {
+		names := make([]string, 0, len(set))
+		for name := range set {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			lists = append(lists, set[name])
+		}
+	}
+	return lists
+}
+
+// ParseList reads a loot container or group element.
+//
+// The list is returned even if some of its values can not be read, with the
+// first such value reported as an error.
+func ParseList(element *etree.Element) (*List, error) {
+	l := &List{
+		Element:         element,
+		Name:            element.SelectAttrValue(AttrName, ""),
+		Container:       element.Tag == TagContainer,
+		MinCount:        1,
+		MaxCount:        1,
+		QualityTemplate: element.SelectAttrValue(AttrQualityTemplate, ""),
+	}
+	if l.Name == "" {
+		// Containers were identified by number before they were named.
+		l.Name = element.SelectAttrValue(AttrID, "")
+	}
+
+	var first error
+	fail := func(err error) {
+		if first == nil {
+			first = fmt.Errorf("%s %q: %v", element.Tag, l.Name, err)
+		}
+	}
+	if count := element.SelectAttrValue(AttrCount, ""); count != "" {
+		if strings.EqualFold(count, CountAll) {
+			l.All = true
+		} else if min, max, err := parseRange(count); err != nil {
+			fail(fmt.Errorf("invalid %s %q", AttrCount, count))
+		} else {
+			l.MinCount, l.MaxCount = int(min), int(max)
+		}
+	}
+
+	for _, child := range element.SelectElements(TagItem) {
+		e := &Entry{
+			Element:         child,
+			Item:            child.SelectAttrValue(AttrName, ""),
+			Group:           child.SelectAttrValue(AttrGroup, ""),
+			Prob:            1,
+			ProbTemplate:    child.SelectAttrValue(AttrProbTemplate, ""),
+			QualityTemplate: child.SelectAttrValue(AttrQualityTemplate, ""),
+		}
+		if raw := child.SelectAttrValue(AttrProb, ""); raw != "" {
+			prob, err := strconv.ParseFloat(raw, 64)
+			if err != nil || prob < 0 {
+				fail(fmt.Errorf("invalid %s %q", AttrProb, raw))
+				prob = 0
+			}
+			e.Prob = prob
+		}
+		if raw := child.SelectAttrValue(AttrForceProb, ""); raw != "" {
+			force, err := strconv.ParseBool(raw)
+			if err != nil {
+				fail(fmt.Errorf("invalid %s %q", AttrForceProb, raw))
+			}
+			e.Force = force
+		}
+		if e.Item == "" && e.Group == "" {
+			fail(fmt.Errorf("entry %d names neither an item nor a group", len(l.Entries)+1))
+		}
+		l.Entries = append(l.Entries, e)
+	}
+	return l, first
+}
+
+// parseRange reads a number or a `min,max` range.
+func parseRange(s string) (float64, float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) > 2 {
+		return 0, 0, fmt.Errorf("invalid range %q", s)
+	}
+	values := make([]float64, len(parts))
+	for idx, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		values[idx] = v
+	}
+	if len(values) == 1 {
+		return values[0], values[0], nil
+	}
+	if values[0] > values[1] {
+		return 0, 0, fmt.Errorf("invalid range %q", s)
+	}
+	return values[0], values[1], nil
+}
+
+func parseProbTemplate(element *etree.Element) ([]levelProb, error) {
+	levels := []levelProb{}
+	var first error
+	for _, child := range element.SelectElements(TagTemplateLoot) {
+		min, max, err := parseRange(child.SelectAttrValue(AttrLevel, ""))
+		if err != nil && first == nil {
+			first = fmt.Errorf("%s %q: invalid %s", element.Tag, element.SelectAttrValue(AttrName, ""), AttrLevel)
+		}
+		prob, perr := strconv.ParseFloat(child.SelectAttrValue(AttrProb, ""), 64)
+		if perr != nil && first == nil {
+			first = fmt.Errorf("%s %q: invalid %s", element.Tag, element.SelectAttrValue(AttrName, ""), AttrProb)
+		}
+		if err == nil && perr == nil {
+			levels = append(levels, levelProb{min: min, max: max, prob: prob})
+		}
+	}
+	return levels, first
+}
+
+// Weight returns the weight of an entry, looking up its prob template for the
+// loot level of the model if it has one. An entry whose template has no value
+// for the level has no weight.
+func (m *Model) Weight(e *Entry) float64 {
+	if e.ProbTemplate == "" {
+		return e.Prob
+	}
+	for _, l := range m.probTemplates[e.ProbTemplate] {
+		if m.Level >= l.min && m.Level <= l.max {
+			return l.prob
+		}
+	}
+	return 0
+}
+
+// QualityTemplate returns the quality template an entry of the list uses, or
+// nil if it has none.
+func (m *Model) QualityTemplate(l *List, e *Entry) *etree.Element {
+	if e.QualityTemplate != "" {
+		return m.qualityTemplates[e.QualityTemplate]
+	}
+	return m.qualityTemplates[l.QualityTemplate]
+}
+
+// EntryChance returns the chance that the entry is picked at least once when
+// the list is looted.
+func (m *Model) EntryChance(l *List, e *Entry) float64 {
+	return m.entryChance(l, e, m.Weight(e))
+}
+
+// entryChance returns the chance the entry would be picked if it had the
+// given weight.
+func (m *Model) entryChance(l *List, e *Entry, weight float64) float64 {
+	if e.Force || l.All {
+		return math.Min(1, weight)
+	}
+	total := weight
+	for _, other := range l.Entries {
+		if other != e && !other.Force {
+			total += m.Weight(other)
+		}
+	}
+	if total <= 0 || l.MaxCount <= 0 {
+		return 0
+	}
+	p := weight / total
+	chance := 0.0
+	for n := l.MinCount; n <= l.MaxCount; n++ {
+		chance += 1 - math.Pow(1-p, float64(n))
+	}
+	return chance / float64(l.MaxCount-l.MinCount+1)
+}
+
+// Chance returns the chance that looting the named container yields the item
+// at least once.
+func (m *Model) Chance(container, item string) (float64, error) {
+	l := m.Containers[container]
+	if l == nil {
+		return 0, fmt.Errorf("unknown container %q", container)
+	}
+	chances, err := m.Chances(l)
+	if err != nil {
+		return 0, err
+	}
+	return chances[item], nil
+}
+
+// Chances returns the chance that looting the list yields each item it may
+// yield at least once.
+//
+// An error is returned if the list reaches a group which contains itself.
+func (m *Model) Chances(l *List) (map[string]float64, error) {
+	return m.chances(l, map[*List]bool{})
+}
+
+func (m *Model) chances(l *List, visiting map[*List]bool) (map[string]float64, error) {
+	if visiting[l] {
+		return nil, fmt.Errorf("%s %q contains itself", l.Element.Tag, l.Name)
+	}
+	visiting[l] = true
+	defer delete(visiting, l)
+
+	// missed holds the chance that no entry yields each item.
+	missed := map[string]float64{}
+	miss := func(item string, chance float64) {
+		if _, ok := missed[item]; !ok {
+			missed[item] = 1
+		}
+		missed[item] *= 1 - chance
+	}
+	for _, e := range l.Entries {
+		chance := m.EntryChance(l, e)
+		if e.Item != "" {
+			miss(e.Item, chance)
+		}
+		if e.Group == "" {
+			continue
+		}
+		group := m.Groups[e.Group]
+		if group == nil {
+			continue
+		}
+		sub, err := m.chances(group, visiting)
+		if err != nil {
+			return nil, err
+		}
+		for item, c := range sub {
+			miss(item, chance*c)
+		}
+	}
+
+	chances := make(map[string]float64, len(missed))
+	for item, p := range missed {
+		chances[item] = 1 - p
+	}
+	return chances, nil
+}
+
+// ScaleWeight returns the weight which makes the chance of the entry being
+// picked from the list mult times what it is now.
+//
+// An error is returned if no weight gives that chance, such as when the
+// chance would exceed 1 or the entry is the only one which may be picked.
+func (m *Model) ScaleWeight(l *List, e *Entry, mult float64) (float64, error) {
+	if mult < 0 {
+		return 0, fmt.Errorf("the chance can not be scaled by %v", mult)
+	}
+	weight := m.Weight(e)
+	current := m.entryChance(l, e, weight)
+	target := current * mult
+	switch {
+	case mult == 1 || current == 0:
+		return weight, nil
+	case mult == 0:
+		return 0, nil
+	case e.Force || l.All:
+		if target > 1 {
+			return 0, fmt.Errorf("the chance would be %v", target)
+		}
+		return target, nil
+	}
+
+	// The chance grows with the weight, so the weight is found by bisection.
+	lo, hi := 0.0, math.Max(weight, 1)
+	for m.entryChance(l, e, hi) < target {
+		if hi > 1e12 {
+			return 0, fmt.Errorf("the chance can not reach %.4g", target)
+		}
+		hi *= 2
+	}
+	for i := 0; i < 100 && hi-lo > 1e-12*hi; i++ {
+		mid := (lo + hi) / 2
+		if m.entryChance(l, e, mid) < target {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	if math.Abs(m.entryChance(l, e, hi)-target) > 1e-6 {
+		return 0, fmt.Errorf("the chance can not reach %.4g", target)
+	}
+	return hi, nil
+}
+
+// Change is the chance of looting a container yielding an item before and
+// after the loot was changed.
+type Change struct {
+	Container string
+	Item      string
+	Before    float64
+	After     float64
+}
+
+// Compare returns the chance of looting each of the containers yielding the
+// item in both models, ordered by container and item.
+//
+// If containers is empty, every container of either model is compared. If
+// item is empty, every item either model's container may yield is compared.
+func Compare(before, after *Model, containers []string, item string) ([]Change, error) {
+	if len(containers) == 0 {
+		seen := map[string]bool{}
+		for _, m := range []*Model{before, after} {
+			for name := range m.Containers {
+				if !seen[name] {
+					seen[name] = true
+					containers = append(containers, name)
+				}
+			}
+		}
+		sort.Strings(containers)
+	}
+
+	changes := []Change{}
+	for _, name := range containers {
+		old, err := containerChances(before, name)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := containerChances(after, name)
+		if err != nil {
+			return nil, err
+		}
+		if old == nil && updated == nil {
+			return nil, fmt.Errorf("unknown container %q", name)
+		}
+
+		items := []string{}
+		if item != "" {
+			items = append(items, item)
+		} else {
+			for it := range old {
+				items = append(items, it)
+			}
+			for it := range updated {
+				if _, ok := old[it]; !ok {
+					items = append(items, it)
+				}
+			}
+			sort.Strings(items)
+		}
+		for _, it := range items {
+			changes = append(changes, Change{Container: name, Item: it, Before: old[it], After: updated[it]})
+		}
+	}
+	return changes, nil
+}
+
+// containerChances returns the chances of the named container, or nil if the
+// model has no such container.
+func containerChances(m *Model, name string) (map[string]float64, error) {
+	l := m.Containers[name]
+	if l == nil {
+		return nil, nil
+	}
+	return m.Chances(l)
+}
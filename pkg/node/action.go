@@ -1,16 +1,29 @@
 package node
 
 import (
+	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/beevik/etree"
+	"github.com/tvarney/sdtdmod/pkg/errors"
 	"github.com/tvarney/sdtdmod/pkg/node/key"
 )
 
+// Action defines an interface for modifying elements.
+//
+// Apply must not modify the Action, so that a single Action may be applied by
+// several goroutines at once, each to a different document. Only the document
+// of the given element may be read unless another is found through a Resolver.
+//
+// A node is applied to every element it matches, which may include an element
+// and some of its descendants. Actions which update a kind of element as a
+// whole, such as a recipe and its ingredients, only act on that element and
+// leave the elements around it alone, so nothing is updated more than once.
 type Action interface {
-	Apply(*etree.Element) bool
+	Apply(*etree.Element, Reporter) bool
 	Serialize() map[string]interface{}
 }
 
@@ -18,8 +31,12 @@ type Action interface {
 //
 // This combines a multiply, add, and clamp operation all in one. It also
 // contains a precision value used for formatting values back to strings.
+//
+// The operation is applied to `Attribute`, or to every attribute chosen by
+// `Attrs` if it is set.
 type Number struct {
 	Attribute string
+	Attrs     *AttrSelector
 	Mult      float64
 	Add       float64
 	Min       float64
@@ -46,44 +63,51 @@ func NewNumber(attr string) *Number {
 // This will take the attribute in the element, multiply it by `Mult`, add
 // `Add`, clamp between `Min` and `Max` inclusive, then truncate to `Precision`
 // decimal places.
-func (n *Number) Apply(element *etree.Element) bool {
+func (n *Number) Apply(element *etree.Element, r Reporter) bool {
 	if n.If != nil && !n.If.Check(element) {
 		return false
 	}
 
-	attr := element.SelectAttr(n.Attribute)
-	if attr == nil {
-		return false
-	}
-
-	if !strings.Contains(attr.Value, ",") {
-		v, err := n.update(attr.Value)
+	updated := false
+	for _, name := range targets(element, n.Attribute, n.Attrs) {
+		attr := element.SelectAttr(name)
+		if attr == nil {
+			continue
+		}
+		v, err := n.transform(attr.Value)
 		if err != nil {
-			return false
+			continue
+		}
+		if setAttr(element, name, v, r) {
+			updated = true
 		}
-		old := attr.Value
-		attr.Value = v
-		return old != attr.Value
+	}
+	return updated
+}
+
+// transform applies the operation to every entry of a comma separated list of
+// numbers.
+func (n *Number) transform(value string) (string, error) {
+	if !strings.Contains(value, ",") {
+		return n.update(value)
 	}
 
 	builder := strings.Builder{}
-	parts := strings.Split(attr.Value, ",")
+	parts := strings.Split(value, ",")
 	v, err := n.update(parts[0])
 	if err != nil {
-		return false
+		return "", err
 	}
 	builder.WriteString(v)
 	for _, p := range parts[1:] {
 		v, err = n.update(p)
 		if err != nil {
-			return false
+			return "", err
 		}
 		builder.WriteRune(',')
 		builder.WriteString(v)
 	}
-	old := attr.Value
-	attr.Value = builder.String()
-	return (old != attr.Value)
+	return builder.String(), nil
 }
 
 func (n *Number) update(value string) (string, error) {
@@ -93,7 +117,7 @@ func (n *Number) update(value string) (string, error) {
 	}
 	v = math.Max(math.Min((n.Mult*v)+n.Add, n.Max), n.Min)
 	s := strconv.FormatFloat(v, 'f', n.Precision, 64)
-	if s[len(s)-1] == '0' {
+	if strings.ContainsRune(s, '.') && s[len(s)-1] == '0' {
 		// Find non-zero end index
 		for lastIdx := len(s) - 1; lastIdx > 0; lastIdx-- {
 			if s[lastIdx] == '.' {
@@ -113,11 +137,28 @@ func (n *Number) update(value string) (string, error) {
 	return s, nil
 }
 
+// Targets returns the names of the attributes of the element the operation is
+// applied to.
+func (n *Number) Targets(element *etree.Element) []string {
+	return targets(element, n.Attribute, n.Attrs)
+}
+
+// Validate checks that the operation is able to update the value, returning
+// the error which would cause Apply to skip it otherwise.
+func (n *Number) Validate(value string) error {
+	_, err := n.transform(value)
+	return err
+}
+
 // Serialize returns JSON compatible map of this Action.
 func (n *Number) Serialize() map[string]interface{} {
 	m := map[string]interface{}{
 		key.Type: key.ActionNumber,
-		"name":   n.Attribute,
+	}
+	if n.Attrs != nil {
+		m[key.Attrs] = n.Attrs.Serialize()
+	} else {
+		m[key.Attr] = n.Attribute
 	}
 	if n.Mult != 1.0 {
 		m["mult"] = n.Mult
@@ -142,49 +183,79 @@ func (n *Number) Serialize() map[string]interface{} {
 }
 
 // RemoveAttr is an Action which removes an attribute from the element.
+//
+// If `Attrs` is set, every attribute it selects is removed instead.
 type RemoveAttr struct {
 	Attribute string
+	Attrs     *AttrSelector
 	If        Match
 }
 
-func (r *RemoveAttr) Apply(element *etree.Element) bool {
-	if r.If != nil && !r.If.Check(element) {
+func (a *RemoveAttr) Apply(element *etree.Element, r Reporter) bool {
+	if a.If != nil && !a.If.Check(element) {
 		return false
 	}
-	return element.RemoveAttr(r.Attribute) != nil
+	updated := false
+	for _, name := range targets(element, a.Attribute, a.Attrs) {
+		if removeAttr(element, name, r) {
+			updated = true
+		}
+	}
+	return updated
+}
+
+// Targets returns the names of the attributes of the element to remove.
+func (a *RemoveAttr) Targets(element *etree.Element) []string {
+	return targets(element, a.Attribute, a.Attrs)
 }
 
-func (r *RemoveAttr) Serialize() map[string]interface{} {
+func (a *RemoveAttr) Serialize() map[string]interface{} {
 	m := map[string]interface{}{
 		key.Type: key.ActionRemoveAttr,
-		"name":   r.Attribute,
 	}
-	if r.If != nil {
-		m["if"] = r.If.Serialize()
+	if a.Attrs != nil {
+		m[key.Attrs] = a.Attrs.Serialize()
+	} else {
+		m[key.Name] = a.Attribute
+	}
+	if a.If != nil {
+		m["if"] = a.If.Serialize()
 	}
 	return m
 }
 
 // InsertAttr is an Action which inserts an attribute into the element.
+//
+// If `Attrs` is set, every attribute it selects is set to the value instead.
 type InsertAttr struct {
 	Attribute string
+	Attrs     *AttrSelector
 	Value     string
 	If        Match
 }
 
-func (i *InsertAttr) Apply(element *etree.Element) bool {
+func (i *InsertAttr) Apply(element *etree.Element, r Reporter) bool {
 	if i.If != nil && !i.If.Check(element) {
 		return false
 	}
-	element.CreateAttr(i.Attribute, i.Value)
-	return true
+	updated := false
+	for _, name := range targets(element, i.Attribute, i.Attrs) {
+		if setAttr(element, name, i.Value, r) {
+			updated = true
+		}
+	}
+	return updated
 }
 
 func (i *InsertAttr) Serialize() map[string]interface{} {
 	m := map[string]interface{}{
-		key.Type: key.ActionInsertAttr,
-		"name":   i.Attribute,
-		"value":  i.Value,
+		key.Type:  key.ActionInsertAttr,
+		key.Value: i.Value,
+	}
+	if i.Attrs != nil {
+		m[key.Attrs] = i.Attrs.Serialize()
+	} else {
+		m[key.Name] = i.Attribute
 	}
 	if i.If != nil {
 		m["if"] = i.If.Serialize()
@@ -192,3 +263,307 @@ func (i *InsertAttr) Serialize() map[string]interface{} {
 
 	return m
 }
+
+// AppendText is an Action which appends text to an attribute of the element,
+// creating the attribute if it does not exist.
+//
+// If `Attrs` is set, the text is appended to every attribute it selects
+// instead.
+type AppendText struct {
+	Attribute string
+	Attrs     *AttrSelector
+	Value     string
+	If        Match
+}
+
+func (a *AppendText) Apply(element *etree.Element, r Reporter) bool {
+	if a.If != nil && !a.If.Check(element) {
+		return false
+	}
+	if a.Value == "" {
+		return false
+	}
+	updated := false
+	for _, name := range targets(element, a.Attribute, a.Attrs) {
+		value := a.Value
+		if attr := element.SelectAttr(name); attr != nil {
+			value = attr.Value + value
+		}
+		if setAttr(element, name, value, r) {
+			updated = true
+		}
+	}
+	return updated
+}
+
+func (a *AppendText) Serialize() map[string]interface{} {
+	m := map[string]interface{}{
+		key.Type:  key.ActionAppendText,
+		key.Value: a.Value,
+	}
+	if a.Attrs != nil {
+		m[key.Attrs] = a.Attrs.Serialize()
+	} else {
+		m[key.Name] = a.Attribute
+	}
+	if a.If != nil {
+		m[key.Cond] = a.If.Serialize()
+	}
+	return m
+}
+
+// CloneElement is an Action which inserts a copy of the element after it, with
+// the attributes in `Set` set on the copy.
+//
+// The values of `Set` may contain placeholders of the form `{@attr}`, which
+// are replaced by the value of that attribute on the element being copied. No
+// copy is made if a sibling with the same tag already has every attribute of
+// `Set` with the same value, so that applying the action again does not add
+// the element twice.
+//
+// The copy is not visited by nodes in the pass which made it, so values it
+// needs must be given in `Set`.
+type CloneElement struct {
+	Set map[string]string
+	If  Match
+}
+
+// Apply inserts the copy of the element, reporting every attribute of the
+// copy as added.
+func (c *CloneElement) Apply(element *etree.Element, r Reporter) bool {
+	if c.If != nil && !c.If.Check(element) {
+		return false
+	}
+	parent := element.Parent()
+	if parent == nil {
+		r.Warn(element, fmt.Errorf("the root element can not be cloned"))
+		return false
+	}
+
+	names := make([]string, 0, len(c.Set))
+	for name := range c.Set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := make([]string, len(names))
+	for idx, name := range names {
+		value, err := ExpandPlaceholders(c.Set[name], func(attr string) (string, bool) {
+			a := element.SelectAttr(attr)
+			if a == nil {
+				return "", false
+			}
+			return a.Value, true
+		})
+		if err != nil {
+			r.Warn(element, err)
+			return false
+		}
+		values[idx] = value
+	}
+
+	for _, sibling := range parent.SelectElements(element.Tag) {
+		if hasValues(sibling, names, values) {
+			return false
+		}
+	}
+
+	clone := element.Copy()
+	for idx, name := range names {
+		clone.CreateAttr(name, values[idx])
+	}
+	parent.InsertChildAt(element.Index()+1, clone)
+	for _, attr := range clone.Attr {
+		r.Change(Change{Element: clone, Attr: attr.FullKey(), New: attr.Value, Added: true})
+	}
+	return true
+}
+
+// hasValues checks if the element has each of the attributes with the value at
+// the same position.
+func hasValues(element *etree.Element, names, values []string) bool {
+	for idx, name := range names {
+		attr := element.SelectAttr(name)
+		if attr == nil || attr.Value != values[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *CloneElement) Serialize() map[string]interface{} {
+	set := make(map[string]interface{}, len(c.Set))
+	for k, v := range c.Set {
+		set[k] = v
+	}
+	m := map[string]interface{}{
+		key.Type: key.ActionCloneElement,
+		key.Set:  set,
+	}
+	if c.If != nil {
+		m[key.Cond] = c.If.Serialize()
+	}
+	return m
+}
+
+// CopyFrom is an Action which copies a value from another element of the
+// document into an attribute of the element.
+//
+// The source element is the first element selected by `Path` which also
+// matches `Source`. The path may contain placeholders of the form `{@attr}`
+// which are replaced by the value of that attribute on the element being
+// updated; a value containing `'`, `[` or `]` is reported as a warning, as
+// it can not be quoted in a path. If `Document` is set, the path is
+// evaluated against that document instead of the one containing the element.
+//
+// The value is read from the `From` attribute of the source and, if
+// `Transform` is set, passed through it before being written.
+type CopyFrom struct {
+	Attribute string
+	Path      string
+	Document  string
+	Source    Match
+	From      string
+	Transform *Number
+	If        Match
+}
+
+// Apply copies the source value into the given element.
+//
+// A missing source element or source attribute is reported as a warning.
+func (c *CopyFrom) Apply(element *etree.Element, r Reporter) bool {
+	if c.If != nil && !c.If.Check(element) {
+		return false
+	}
+
+	src, err := c.find(element, r)
+	if err != nil {
+		r.Warn(element, err)
+		return false
+	}
+	attr := src.SelectAttr(c.From)
+	if attr == nil {
+		r.Warn(element, errors.MissingAttributeError(c.From))
+		return false
+	}
+
+	value := attr.Value
+	if c.Transform != nil {
+		value, err = c.Transform.transform(value)
+		if err != nil {
+			r.Warn(element, err)
+			return false
+		}
+	}
+
+	return setAttr(element, c.Attribute, value, r)
+}
+
+func (c *CopyFrom) find(element *etree.Element, r Reporter) (*etree.Element, error) {
+	raw := c.Path
+	if raw == "" {
+		raw = "//*"
+	}
+	var invalid error
+	raw, err := ExpandPlaceholders(raw, func(name string) (string, bool) {
+		attr := element.SelectAttr(name)
+		if attr == nil {
+			return "", false
+		}
+		// etree paths can not escape quotes or brackets, so a value containing
+		// them would change the meaning of the path.
+		if invalid == nil && strings.ContainsAny(attr.Value, "'[]") {
+			invalid = fmt.Errorf("value %q of attribute %s can not be used in a path", attr.Value, name)
+		}
+		return attr.Value, true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if invalid != nil {
+		return nil, invalid
+	}
+	path, err := etree.CompilePath(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	base := element
+	if c.Document != "" {
+		resolver, ok := r.(Resolver)
+		if !ok {
+			return nil, errors.MissingSourceError(c.Document)
+		}
+		doc := resolver.Resolve(c.Document)
+		if doc == nil {
+			return nil, errors.MissingSourceError(c.Document)
+		}
+		base = &doc.Element
+	}
+
+	for _, e := range base.FindElementsPath(path) {
+		if e != element && (c.Source == nil || c.Source.Check(e)) {
+			return e, nil
+		}
+	}
+	return nil, errors.MissingSourceError(raw)
+}
+
+func (c *CopyFrom) Serialize() map[string]interface{} {
+	m := map[string]interface{}{
+		key.Type: key.ActionCopyFrom,
+		key.Attr: c.Attribute,
+		key.From: c.From,
+	}
+	if c.Path != "" {
+		m[key.Path] = c.Path
+	}
+	if c.Document != "" {
+		m[key.Document] = c.Document
+	}
+	if c.Source != nil {
+		m[key.Match] = c.Source.Serialize()
+	}
+	if c.Transform != nil {
+		for k, v := range c.Transform.Serialize() {
+			if k != key.Type && k != key.Attr && k != key.Cond {
+				m[k] = v
+			}
+		}
+	}
+	if c.If != nil {
+		m[key.Cond] = c.If.Serialize()
+	}
+	return m
+}
+
+// ExpandPlaceholders replaces every `{@name}` placeholder in the string with
+// the value returned by lookup.
+//
+// An error is returned if a placeholder is not terminated or if lookup does
+// not find a value for it.
+func ExpandPlaceholders(s string, lookup func(string) (string, bool)) (string, error) {
+	if !strings.Contains(s, "{@") {
+		return s, nil
+	}
+
+	builder := strings.Builder{}
+	for {
+		start := strings.Index(s, "{@")
+		if start < 0 {
+			builder.WriteString(s)
+			return builder.String(), nil
+		}
+		end := strings.IndexRune(s[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated placeholder in %q", s)
+		}
+		name := s[start+2 : start+end]
+		value, ok := lookup(name)
+		if !ok {
+			return "", errors.MissingAttributeError(name)
+		}
+		builder.WriteString(s[:start])
+		builder.WriteString(value)
+		s = s[start+end+1:]
+	}
+}
@@ -0,0 +1,51 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+type warnings struct {
+	Discard
+	errs []error
+}
+
+func (w *warnings) Warn(element *etree.Element, err error) {
+	w.errs = append(w.errs, err)
+}
+
+// TestCopyFromPlaceholderValues checks that a placeholder value which would
+// change the meaning of the path is reported instead of being used.
+func TestCopyFromPlaceholderValues(t *testing.T) {
+	tests := []struct {
+		name string
+		base string
+		want string
+	}{
+		{"plain", "a", "1"},
+		{"slash", "a/b", "2"},
+		{"quote", "a' or @name='b", ""},
+		{"bracket", "a]", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := etree.NewDocument()
+			err := doc.ReadFromString(`<root><base name="a" value="1"/><base name="a/b" value="2"/><base name="b" value="3"/><item/></root>`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			item := doc.FindElement("//item")
+			item.CreateAttr("base", test.base)
+			action := &CopyFrom{Attribute: "copied", Path: "/root/base[@name='{@base}']", From: "value"}
+			w := &warnings{}
+			action.Apply(item, w)
+			if got := item.SelectAttrValue("copied", ""); got != test.want {
+				t.Errorf("copied %q, expected %q", got, test.want)
+			}
+			if test.want == "" && len(w.errs) != 1 {
+				t.Errorf("got warnings %v, expected one", w.errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package node
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/tvarney/sdtdmod/pkg/node/key"
+)
+
+// AttrSelector selects a set of attributes of an element.
+//
+// Every attribute listed in `Names` is selected, along with every existing
+// attribute of the element which satisfies all of the `Prefix`, `Suffix`, and
+// `Regex` constraints that are set.
+type AttrSelector struct {
+	Names  []string
+	Prefix string
+	Suffix string
+	Regex  *regexp.Regexp
+}
+
+// Select returns the names of the selected attributes of the element.
+//
+// Names listed explicitly are returned whether or not the element has them,
+// which allows actions to create them.
+func (s *AttrSelector) Select(element *etree.Element) []string {
+	names := make([]string, 0, len(s.Names))
+	names = append(names, s.Names...)
+	if s.Prefix == "" && s.Suffix == "" && s.Regex == nil {
+		return names
+	}
+
+	for _, attr := range element.Attr {
+		name := attr.FullKey()
+		if s.check(name) && !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (s *AttrSelector) check(name string) bool {
+	if s.Prefix != "" && !strings.HasPrefix(name, s.Prefix) {
+		return false
+	}
+	if s.Suffix != "" && !strings.HasSuffix(name, s.Suffix) {
+		return false
+	}
+	if s.Regex != nil && !s.Regex.MatchString(name) {
+		return false
+	}
+	return true
+}
+
+// Serialize returns a JSON compatible value for this selector.
+//
+// A selector which only lists names is serialized as a list.
+func (s *AttrSelector) Serialize() interface{} {
+	if s.Prefix == "" && s.Suffix == "" && s.Regex == nil {
+		names := make([]interface{}, 0, len(s.Names))
+		for _, n := range s.Names {
+			names = append(names, n)
+		}
+		return names
+	}
+
+	m := map[string]interface{}{}
+	if len(s.Names) > 0 {
+		m[key.Names] = s.Names
+	}
+	if s.Prefix != "" {
+		m[key.Prefix] = s.Prefix
+	}
+	if s.Suffix != "" {
+		m[key.Suffix] = s.Suffix
+	}
+	if s.Regex != nil {
+		m[key.Regex] = s.Regex.String()
+	}
+	return m
+}
+
+// targets returns the attributes an action should operate on, which is either
+// the single named attribute or those chosen by the selector.
+func targets(element *etree.Element, attr string, sel *AttrSelector) []string {
+	if sel != nil {
+		return sel.Select(element)
+	}
+	return []string{attr}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package node
+
+import "github.com/beevik/etree"
+
+// Targeted is implemented by Actions which update attributes the element
+// already has. Attributes returned by Targets which the element does not have
+// are skipped by Apply.
+type Targeted interface {
+	Targets(element *etree.Element) []string
+}
+
+var _ Targeted = &Number{}
+var _ Targeted = &RemoveAttr{}
+
+// Condition returns the match an action requires elements to satisfy before
+// it is applied, or nil if it has none.
+func Condition(a Action) Match {
+	switch v := a.(type) {
+	case *Number:
+		return v.If
+	case *RemoveAttr:
+		return v.If
+	case *InsertAttr:
+		return v.If
+	case *AppendText:
+		return v.If
+	case *CloneElement:
+		return v.If
+	case *CopyFrom:
+		return v.If
+	case *ScaleLoot:
+		return v.If
+	case *ScaleRecipe:
+		return v.If
+	case *ScalePassiveEffect:
+		return v.If
+	case *AddPassiveEffect:
+		return v.If
+	}
+	return nil
+}
+
+// ReadsDocuments checks if any action of the nodes or their children reads
+// from a document other than the one being updated.
+//
+// Nodes which do not may be applied to several documents at once; otherwise
+// the documents must be updated one at a time, in order, so that actions see
+// the earlier documents as updated.
+func ReadsDocuments(nodes []*Node) bool {
+	for _, n := range nodes {
+		for _, a := range n.Actions {
+			if c, ok := a.(*CopyFrom); ok && c.Document != "" {
+				return true
+			}
+			if s, ok := a.(*ScaleRecipe); ok && len(s.Tags) > 0 {
+				return true
+			}
+		}
+		if ReadsDocuments(n.Children) {
+			return true
+		}
+	}
+	return false
+}
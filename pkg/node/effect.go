@@ -0,0 +1,393 @@
+package node
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/tvarney/sdtdmod/pkg/node/key"
+)
+
+// Tags and attributes of passive effects in items.xml, progression.xml, and
+// buffs.xml.
+const (
+	PassiveEffectTag = "passive_effect"
+	EffectGroupTag   = "effect_group"
+	EffectName       = "name"
+	EffectOperation  = "operation"
+	EffectValue      = "value"
+	EffectTier       = "tier"
+	EffectTags       = "tags"
+)
+
+// PassiveEffectMatch is a Match which checks `passive_effect` elements.
+//
+// Each constraint which is set must hold: the effect has the `Name` and
+// `Operation`, has every one of `Tags` in its comma separated tags, and
+// applies to `Tier`. An effect without a tier list applies to every tier;
+// one whose tier list is a `min,max` range applies to every tier in it.
+type PassiveEffectMatch struct {
+	Name      string
+	Operation string
+	Tags      []string
+	Tier      int
+}
+
+func (p *PassiveEffectMatch) Check(element *etree.Element) bool {
+	if element.Tag != PassiveEffectTag {
+		return false
+	}
+	if p.Name != "" && element.SelectAttrValue(EffectName, "") != p.Name {
+		return false
+	}
+	if p.Operation != "" && !strings.EqualFold(element.SelectAttrValue(EffectOperation, ""), p.Operation) {
+		return false
+	}
+	if len(p.Tags) > 0 {
+		tags := splitList(element.SelectAttrValue(EffectTags, ""))
+		for _, tag := range p.Tags {
+			if !contains(tags, tag) {
+				return false
+			}
+		}
+	}
+	if p.Tier > 0 {
+		attr := element.SelectAttr(EffectTier)
+		if attr == nil {
+			return true
+		}
+		tiers, err := parseTiers(attr.Value)
+		if err != nil {
+			return false
+		}
+		return tierIndex(tiers, p.Tier) >= 0 || inRange(tiers, p.Tier)
+	}
+	return true
+}
+
+func (p *PassiveEffectMatch) Serialize() map[string]interface{} {
+	m := map[string]interface{}{
+		key.Type: key.MatchPassiveEffect,
+	}
+	if p.Name != "" {
+		m[key.Name] = p.Name
+	}
+	if p.Operation != "" {
+		m[key.Operation] = p.Operation
+	}
+	if len(p.Tags) > 0 {
+		m[key.Tags] = p.Tags
+	}
+	if p.Tier > 0 {
+		m[key.Tier] = p.Tier
+	}
+	return m
+}
+
+// ScalePassiveEffect is an Action which updates the values of a
+// `passive_effect` element tier by tier.
+//
+// The `value` and `tier` attributes of an effect are comma separated lists
+// which line up, the n-th value being that of the n-th tier. Each value whose
+// tier is in `Tiers`, or every value if `Tiers` is empty, is updated by
+// `Number`. A single value shared by several tiers is first split into one
+// value per tier, and a `min,max` tier range is first split into every tier
+// in it, with the values between interpolated, so that only the chosen tiers
+// change.
+type ScalePassiveEffect struct {
+	Number *Number
+	Tiers  []int
+	If     Match
+}
+
+// Apply updates the values of the effect.
+//
+// An effect whose value and tier lists do not line up is left alone with a
+// warning, as is one with no tier list when `Tiers` is set. An effect with
+// none of `Tiers`, or whose values are not changed, is left as it is.
+func (s *ScalePassiveEffect) Apply(element *etree.Element, r Reporter) bool {
+	if s.If != nil && !s.If.Check(element) {
+		return false
+	}
+	valueAttr := element.SelectAttr(EffectValue)
+	if valueAttr == nil {
+		return false
+	}
+	values := splitList(valueAttr.Value)
+
+	tierAttr := element.SelectAttr(EffectTier)
+	if tierAttr == nil {
+		if len(s.Tiers) > 0 {
+			r.Warn(element, fmt.Errorf("the effect has no %s list to choose values from", EffectTier))
+			return false
+		}
+		v, err := s.Number.transform(valueAttr.Value)
+		if err != nil {
+			r.Warn(element, err)
+			return false
+		}
+		return setAttr(element, EffectValue, v, r)
+	}
+
+	tiers, err := parseTiers(tierAttr.Value)
+	if err != nil {
+		r.Warn(element, err)
+		return false
+	}
+	if !s.selects(tiers) {
+		return false
+	}
+	if len(values) == 1 && len(tiers) > 1 {
+		if len(s.Tiers) == 0 {
+			v, err := s.Number.transform(valueAttr.Value)
+			if err != nil {
+				r.Warn(element, err)
+				return false
+			}
+			return setAttr(element, EffectValue, v, r)
+		}
+		for len(values) < len(tiers) {
+			values = append(values, values[0])
+		}
+	}
+	if len(values) != len(tiers) {
+		r.Warn(element, fmt.Errorf("%d values do not line up with %d tiers", len(values), len(tiers)))
+		return false
+	}
+	split := s.splitsRange(tiers)
+	if split {
+		tiers, values, err = expandRange(tiers, values)
+		if err != nil {
+			r.Warn(element, err)
+			return false
+		}
+	}
+
+	changed := false
+	for idx, tier := range tiers {
+		if len(s.Tiers) > 0 && !containsInt(s.Tiers, tier) {
+			continue
+		}
+		v, err := s.Number.update(values[idx])
+		if err != nil {
+			r.Warn(element, err)
+			return false
+		}
+		changed = changed || v != values[idx]
+		values[idx] = v
+	}
+	// The lists are only rewritten when a value changes, so that effects
+	// the action does not update keep their formatting.
+	if !changed {
+		return false
+	}
+
+	updated := false
+	if split {
+		updated = setAttr(element, EffectTier, joinTiers(tiers), r)
+	}
+	if setAttr(element, EffectValue, strings.Join(values, ","), r) {
+		updated = true
+	}
+	return updated
+}
+
+// selects checks if any of the tiers, or of the tiers in a `min,max` range,
+// is one to update.
+func (s *ScalePassiveEffect) selects(tiers []int) bool {
+	if len(s.Tiers) == 0 {
+		return true
+	}
+	for _, tier := range s.Tiers {
+		if containsInt(tiers, tier) || inRange(tiers, tier) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitsRange checks if the tiers are a `min,max` range which contains a tier
+// to update, including either end, but also a tier which is not to be
+// updated.
+func (s *ScalePassiveEffect) splitsRange(tiers []int) bool {
+	if len(tiers) != 2 || tiers[1]-tiers[0] < 2 || len(s.Tiers) == 0 {
+		return false
+	}
+	for tier := tiers[0]; tier <= tiers[1]; tier++ {
+		if !containsInt(s.Tiers, tier) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ScalePassiveEffect) Serialize() map[string]interface{} {
+	m := map[string]interface{}{}
+	for k, v := range s.Number.Serialize() {
+		if k != key.Attr && k != key.Cond {
+			m[k] = v
+		}
+	}
+	m[key.Type] = key.ActionScalePassiveEffect
+	if len(s.Tiers) > 0 {
+		m[key.Tiers] = s.Tiers
+	}
+	if s.If != nil {
+		m[key.Cond] = s.If.Serialize()
+	}
+	return m
+}
+
+// AddPassiveEffect is an Action which adds a `passive_effect` to an
+// `effect_group` which has no effect with the same name and operation.
+//
+// The new effect has the `Name`, `Operation`, and `Value` given, along with
+// `Tier` and `Tags` if they are set.
+type AddPassiveEffect struct {
+	Name      string
+	Operation string
+	Value     string
+	Tier      string
+	Tags      []string
+	If        Match
+}
+
+// Apply adds the effect to the element, reporting each of its attributes as
+// added. Elements other than effect groups are left alone.
+func (a *AddPassiveEffect) Apply(element *etree.Element, r Reporter) bool {
+	if a.If != nil && !a.If.Check(element) {
+		return false
+	}
+	if element.Tag != EffectGroupTag {
+		return false
+	}
+	existing := &PassiveEffectMatch{Name: a.Name, Operation: a.Operation}
+	for _, child := range element.SelectElements(PassiveEffectTag) {
+		if existing.Check(child) {
+			return false
+		}
+	}
+
+	effect := etree.NewElement(PassiveEffectTag)
+	effect.CreateAttr(EffectName, a.Name)
+	effect.CreateAttr(EffectOperation, a.Operation)
+	effect.CreateAttr(EffectValue, a.Value)
+	if a.Tier != "" {
+		effect.CreateAttr(EffectTier, a.Tier)
+	}
+	if len(a.Tags) > 0 {
+		effect.CreateAttr(EffectTags, strings.Join(a.Tags, ","))
+	}
+
+	// Effects go after the last effect of the group, so they are kept
+	// together with those already there.
+	at := len(element.Child)
+	if effects := element.SelectElements(PassiveEffectTag); len(effects) > 0 {
+		at = effects[len(effects)-1].Index() + 1
+	}
+	element.InsertChildAt(at, effect)
+	for _, attr := range effect.Attr {
+		r.Change(Change{Element: effect, Attr: attr.Key, New: attr.Value, Added: true})
+	}
+	return true
+}
+
+func (a *AddPassiveEffect) Serialize() map[string]interface{} {
+	m := map[string]interface{}{
+		key.Type:      key.ActionAddPassiveEffect,
+		key.Name:      a.Name,
+		key.Operation: a.Operation,
+		key.Value:     a.Value,
+	}
+	if a.Tier != "" {
+		m[key.Tier] = a.Tier
+	}
+	if len(a.Tags) > 0 {
+		m[key.Tags] = a.Tags
+	}
+	if a.If != nil {
+		m[key.Cond] = a.If.Serialize()
+	}
+	return m
+}
+
+// splitList splits a comma separated list, trimming the space around each
+// entry.
+func splitList(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	parts := strings.Split(s, ",")
+	for idx, p := range parts {
+		parts[idx] = strings.TrimSpace(p)
+	}
+	return parts
+}
+
+func parseTiers(s string) ([]int, error) {
+	parts := splitList(s)
+	tiers := make([]int, len(parts))
+	for idx, p := range parts {
+		tier, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s list %q", EffectTier, s)
+		}
+		tiers[idx] = tier
+	}
+	return tiers, nil
+}
+
+func joinTiers(tiers []int) string {
+	parts := make([]string, len(tiers))
+	for idx, tier := range tiers {
+		parts[idx] = strconv.Itoa(tier)
+	}
+	return strings.Join(parts, ",")
+}
+
+func tierIndex(tiers []int, tier int) int {
+	for idx, t := range tiers {
+		if t == tier {
+			return idx
+		}
+	}
+	return -1
+}
+
+func inRange(tiers []int, tier int) bool {
+	return len(tiers) == 2 && tier >= tiers[0] && tier <= tiers[1]
+}
+
+func containsInt(values []int, value int) bool {
+	return tierIndex(values, value) >= 0
+}
+
+// expandRange splits a `min,max` tier range and its two values into one
+// entry per tier, interpolating the values in between.
+func expandRange(tiers []int, values []string) ([]int, []string, error) {
+	lo, err := strconv.ParseFloat(values[0], 64)
+	if err != nil {
+		return nil, nil, err
+	}
+	hi, err := strconv.ParseFloat(values[1], 64)
+	if err != nil {
+		return nil, nil, err
+	}
+	count := tiers[1] - tiers[0]
+	expanded := make([]int, 0, count+1)
+	interpolated := make([]string, 0, count+1)
+	for idx := 0; idx <= count; idx++ {
+		v := lo + (hi-lo)*float64(idx)/float64(count)
+		expanded = append(expanded, tiers[0]+idx)
+		interpolated = append(interpolated, strconv.FormatFloat(roundTo(v, 6), 'f', -1, 64))
+	}
+	interpolated[0], interpolated[count] = values[0], values[1]
+	return expanded, interpolated, nil
+}
+
+func roundTo(v float64, places int) float64 {
+	s := strconv.FormatFloat(v, 'f', places, 64)
+	r, _ := strconv.ParseFloat(s, 64)
+	return r
+}
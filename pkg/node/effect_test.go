@@ -0,0 +1,57 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+func TestScalePassiveEffect(t *testing.T) {
+	tests := []struct {
+		name      string
+		tier      string
+		value     string
+		tiers     []int
+		mult      float64
+		wantTier  string
+		wantValue string
+		updated   bool
+	}{
+		{"every tier", "1,2,3", "1,2,3", nil, 2, "1,2,3", "2,4,6", true},
+		{"chosen tier", "1,2,3", "1,2,3", []int{2}, 2, "1,2,3", "1,4,3", true},
+		{"no tier list", "", "0.5", nil, 2, "", "1", true},
+		{"shared value", "1,2,3", "1", []int{3}, 2, "1,2,3", "1,1,2", true},
+		{"range inside", "1,5", "0.1,0.5", []int{3}, 2, "1,2,3,4,5", "0.1,0.2,0.6,0.4,0.5", true},
+		{"range endpoint", "1,5", "0.1,0.5", []int{1}, 2, "1,2,3,4,5", "0.2,0.2,0.3,0.4,0.5", true},
+		{"whole range", "1,5", "0.1,0.5", []int{1, 2, 3, 4, 5}, 2, "1,5", "0.2,1", true},
+		{"range of two", "1,2", "0.1,0.2", []int{1}, 2, "1,2", "0.2,0.2", true},
+		{"tier not present", "1, 5", "0.1, 0.5", []int{9}, 2, "1, 5", "0.1, 0.5", false},
+		{"shared value tier not present", "1,5", "0.1", []int{9}, 2, "1,5", "0.1", false},
+		{"unchanged", "1, 5", "0.1, 0.5", []int{3}, 1, "1, 5", "0.1, 0.5", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			effect := etree.NewElement(PassiveEffectTag)
+			if test.tier != "" {
+				effect.CreateAttr(EffectTier, test.tier)
+			}
+			effect.CreateAttr(EffectValue, test.value)
+			number := NewNumber("")
+			number.Mult = test.mult
+			action := &ScalePassiveEffect{Number: number, Tiers: test.tiers}
+			w := &warnings{}
+			if got := action.Apply(effect, w); got != test.updated {
+				t.Errorf("updated is %v, expected %v", got, test.updated)
+			}
+			if len(w.errs) > 0 {
+				t.Errorf("unexpected warnings %v", w.errs)
+			}
+			if got := effect.SelectAttrValue(EffectTier, ""); got != test.wantTier {
+				t.Errorf("tier is %q, expected %q", got, test.wantTier)
+			}
+			if got := effect.SelectAttrValue(EffectValue, ""); got != test.wantValue {
+				t.Errorf("value is %q, expected %q", got, test.wantValue)
+			}
+		})
+	}
+}
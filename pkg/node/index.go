@@ -0,0 +1,236 @@
+package node
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Index applies a list of nodes to elements, only checking the nodes which
+// might match each element.
+//
+// Nodes are filed by the tag names, tag prefixes, and attribute values or
+// value prefixes their matches require, as found in TagMatch, AttrMatch, and
+// PassiveEffectMatch constraints. Nodes whose matches require none of these
+// are checked against every element. The children of each node are indexed
+// the same way.
+//
+// An Index is not modified once built, and may be used by several goroutines
+// at once in the same way as the nodes themselves.
+type Index struct {
+	nodes    []*Node
+	children []*Index
+
+	tags         map[string][]int
+	tagPrefixes  []prefixKey
+	attrValues   map[string]map[string][]int
+	attrPrefixes map[string][]prefixKey
+	always       []int
+}
+
+// prefixKey files a node under a prefix of a tag or attribute value.
+type prefixKey struct {
+	prefix string
+	node   int
+}
+
+// guard is a constraint an element must satisfy for a match to succeed.
+//
+// If attr is set, the element must have the attribute, with a value equal to
+// value if exact is set or starting with it otherwise. If attr is not set, the
+// tag must satisfy the same constraint.
+type guard struct {
+	attr  string
+	value string
+	exact bool
+}
+
+// NewIndex returns an Index of the nodes.
+func NewIndex(nodes []*Node) *Index {
+	x := &Index{
+		nodes:        nodes,
+		children:     make([]*Index, len(nodes)),
+		tags:         map[string][]int{},
+		attrValues:   map[string]map[string][]int{},
+		attrPrefixes: map[string][]prefixKey{},
+	}
+	for idx, n := range nodes {
+		if len(n.Children) > 0 {
+			x.children[idx] = NewIndex(n.Children)
+		}
+		guards, ok := guards(n.Match)
+		if !ok {
+			x.always = append(x.always, idx)
+			continue
+		}
+		for _, g := range guards {
+			if g.attr == "" {
+				if g.exact {
+					x.tags[g.value] = append(x.tags[g.value], idx)
+				} else {
+					x.tagPrefixes = append(x.tagPrefixes, prefixKey{prefix: g.value, node: idx})
+				}
+				continue
+			}
+
+			// Attributes are looked up without their namespace, as AttrMatch
+			// does.
+			name := g.attr
+			if colon := strings.IndexByte(name, ':'); colon >= 0 {
+				name = name[colon+1:]
+			}
+			if !g.exact {
+				x.attrPrefixes[name] = append(x.attrPrefixes[name], prefixKey{prefix: g.value, node: idx})
+				continue
+			}
+			values := x.attrValues[name]
+			if values == nil {
+				values = map[string][]int{}
+				x.attrValues[name] = values
+			}
+			values[g.value] = append(values[g.value], idx)
+		}
+	}
+	return x
+}
+
+// guards returns constraints at least one of which an element must satisfy
+// for the match to succeed, or false if no such constraints are known.
+func guards(m Match) ([]guard, bool) {
+	switch v := m.(type) {
+	case *TagMatch:
+		if v.Value != "" {
+			return []guard{{value: v.Value, exact: true}}, true
+		}
+		if v.Prefix != "" {
+			return []guard{{value: v.Prefix}}, true
+		}
+	case *AttrMatch:
+		if v.Value != "" {
+			return []guard{{attr: v.Attribute, value: v.Value, exact: true}}, true
+		}
+		return []guard{{attr: v.Attribute, value: v.Prefix}}, true
+	case *PassiveEffectMatch:
+		if v.Name != "" {
+			return []guard{{attr: EffectName, value: v.Name, exact: true}}, true
+		}
+		return []guard{{value: PassiveEffectTag, exact: true}}, true
+	case AllOf:
+		// Any single sub-match is enough; prefer the one filing the node
+		// under the most specific keys.
+		var best []guard
+		found := false
+		for _, child := range v {
+			g, ok := guards(child)
+			if ok && (!found || rank(g) < rank(best)) {
+				best, found = g, true
+			}
+		}
+		return best, found
+	case AnyOf:
+		return anyGuards(v)
+	case OneOf:
+		return anyGuards(v)
+	}
+	return nil, false
+}
+
+func anyGuards(matches []Match) ([]guard, bool) {
+	all := []guard{}
+	for _, m := range matches {
+		g, ok := guards(m)
+		if !ok {
+			return nil, false
+		}
+		all = append(all, g...)
+	}
+	return all, len(all) > 0
+}
+
+// rank orders sets of guards by how many elements they are likely to let
+// through. Attribute values such as names are usually unique, while the same
+// tag is shared by many elements, and a bare attribute or a prefix may be
+// shared by most of them.
+func rank(guards []guard) int {
+	worst := 0
+	for _, g := range guards {
+		var r int
+		switch {
+		case g.attr != "" && g.exact:
+			r = 0
+		case g.attr == "" && g.exact:
+			r = 1
+		case g.attr != "" && g.value != "":
+			r = 2
+		case g.attr == "":
+			r = 3
+		default:
+			r = 4
+		}
+		if r > worst {
+			worst = r
+		}
+	}
+	return worst*1000 + len(guards)
+}
+
+// candidates returns the positions of the nodes which might match the
+// element, in order.
+func (x *Index) candidates(element *etree.Element) []int {
+	found := make([]int, 0, len(x.always)+4)
+	found = append(found, x.always...)
+	found = append(found, x.tags[element.Tag]...)
+	for _, k := range x.tagPrefixes {
+		if strings.HasPrefix(element.Tag, k.prefix) {
+			found = append(found, k.node)
+		}
+	}
+	if x.hasAttrs() {
+		for _, attr := range element.Attr {
+			found = append(found, x.attrValues[attr.Key][attr.Value]...)
+			for _, k := range x.attrPrefixes[attr.Key] {
+				if strings.HasPrefix(attr.Value, k.prefix) {
+					found = append(found, k.node)
+				}
+			}
+		}
+	}
+	if len(found) < 2 {
+		return found
+	}
+	sort.Ints(found)
+	unique := found[:1]
+	for _, idx := range found[1:] {
+		if idx != unique[len(unique)-1] {
+			unique = append(unique, idx)
+		}
+	}
+	return unique
+}
+
+func (x *Index) hasAttrs() bool {
+	return len(x.attrValues) > 0 || len(x.attrPrefixes) > 0
+}
+
+// Apply applies every node which matches the element, in order, as if by
+// calling Node.Apply on each node.
+//
+// Since a node may change the attributes later nodes are filed by, the
+// remaining candidates are found again whenever a node changes the element.
+func (x *Index) Apply(element *etree.Element, r Reporter) bool {
+	updated := false
+	candidates := x.candidates(element)
+	for pos := 0; pos < len(candidates); pos++ {
+		idx := candidates[pos]
+		if !x.nodes[idx].apply(element, r, x.children[idx]) {
+			continue
+		}
+		updated = true
+		if x.hasAttrs() {
+			candidates = x.candidates(element)
+			pos = sort.SearchInts(candidates, idx+1) - 1
+		}
+	}
+	return updated
+}
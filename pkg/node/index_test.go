@@ -0,0 +1,123 @@
+package node
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+// blockRules returns rules like those of a large config for blocks.xml, each
+// updating the properties of a few blocks.
+func blockRules(count int) []*Node {
+	nodes := make([]*Node, 0, count+4)
+	for i := 0; i < count; i++ {
+		mult := NewNumber("value")
+		mult.Mult = 2
+		nodes = append(nodes, &Node{
+			Match: AllOf{&TagMatch{Value: "block"}, &AttrMatch{Attribute: "name", Value: fmt.Sprintf("block%d", i*7)}},
+			Children: []*Node{{
+				Match:   AllOf{&TagMatch{Value: "property"}, &AttrMatch{Attribute: "name", Value: "MaxDamage"}},
+				Actions: []Action{mult},
+			}},
+		})
+	}
+	add := NewNumber("value")
+	add.Add = 1
+	return append(nodes,
+		&Node{
+			Match:   AnyOf{&TagMatch{Prefix: "bl"}, &AttrMatch{Attribute: "class", Prefix: "Door"}},
+			Actions: []Action{&InsertAttr{Attribute: "marked", Value: "yes"}},
+		},
+		&Node{
+			// Only matches once the node before has marked the element.
+			Match:   &AttrMatch{Attribute: "marked", Value: "yes"},
+			Actions: []Action{&InsertAttr{Attribute: "seen", Value: "yes"}},
+		},
+		&Node{
+			Match:    &TagMatch{Regex: regexp.MustCompile("^blocks$")},
+			Children: []*Node{{Match: Not{Child: &AttrMatch{Attribute: "class"}}, Actions: []Action{add}}},
+		},
+		&Node{
+			Match:   OneOf{&TagMatch{Value: "property"}, &TagMatch{Value: "drop"}},
+			Actions: []Action{&RemoveAttr{Attribute: "unused"}},
+		},
+	)
+}
+
+// blockDocument returns a document shaped like blocks.xml with the given
+// number of blocks.
+func blockDocument(tb testing.TB, count int) *etree.Document {
+	b := strings.Builder{}
+	b.WriteString("<blocks>\n")
+	for i := 0; i < count; i++ {
+		class := ""
+		if i%10 == 0 {
+			class = ` class="DoorSecure"`
+		}
+		fmt.Fprintf(&b, "<block name=\"block%d\"%s value=\"%d\">\n", i, class, i)
+		fmt.Fprintf(&b, "<property name=\"MaxDamage\" value=\"%d\"/>\n", i*10)
+		fmt.Fprintf(&b, "<property name=\"Material\" value=\"Mwood\" unused=\"1\"/>\n")
+		fmt.Fprintf(&b, "<drop event=\"Harvest\" name=\"resourceWood\" count=\"%d\"/>\n", i%5)
+		b.WriteString("</block>\n")
+	}
+	b.WriteString("</blocks>\n")
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(b.String()); err != nil {
+		tb.Fatal(err)
+	}
+	return doc
+}
+
+// applyIndex applies the index to the element and its descendants.
+func applyIndex(x *Index, element *etree.Element, r Reporter) {
+	x.Apply(element, r)
+	for _, child := range element.ChildElements() {
+		applyIndex(x, child, r)
+	}
+}
+
+func TestIndexMatchesLinear(t *testing.T) {
+	nodes := blockRules(100)
+
+	linear := blockDocument(t, 1000)
+	applyAll(nodes, linear.Root(), Discard{})
+	want, _ := linear.WriteToString()
+
+	indexed := blockDocument(t, 1000)
+	applyIndex(NewIndex(nodes), indexed.Root(), Discard{})
+	got, _ := indexed.WriteToString()
+
+	if got != want {
+		t.Errorf("indexed nodes produced a different document")
+	}
+	if !strings.Contains(want, `seen="yes"`) || !strings.Contains(want, `value="1400"`) {
+		t.Errorf("nodes were not applied")
+	}
+}
+
+func benchmarkApply(b *testing.B, apply func(nodes []*Node, root *etree.Element)) {
+	nodes := blockRules(300)
+	docs := make([]*etree.Document, b.N)
+	for i := range docs {
+		docs[i] = blockDocument(b, 5000)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		apply(nodes, docs[i].Root())
+	}
+}
+
+func BenchmarkApplyLinear(b *testing.B) {
+	benchmarkApply(b, func(nodes []*Node, root *etree.Element) {
+		applyAll(nodes, root, Discard{})
+	})
+}
+
+func BenchmarkApplyIndex(b *testing.B) {
+	benchmarkApply(b, func(nodes []*Node, root *etree.Element) {
+		applyIndex(NewIndex(nodes), root, Discard{})
+	})
+}
@@ -1,43 +1,83 @@
 package key
 
 const (
-	Actions  = "actions"
-	Add      = "add"
-	Attr     = "attr"
-	Children = "children"
-	Cond     = "if"
-	Match    = "match"
-	Matches  = "matches"
-	Max      = "max"
-	Min      = "min"
-	Mult     = "mult"
-	Name     = "name"
-	Prec     = "precision"
-	Prefix   = "prefix"
-	Regex    = "regex"
-	Suffix   = "suffix"
-	Type     = "type"
-	Value    = "value"
+	Actions     = "actions"
+	Add         = "add"
+	Attr        = "attr"
+	Attrs       = "attrs"
+	Children    = "children"
+	CraftTime   = "craft-time"
+	Cond        = "if"
+	Description = "description"
+	Disable     = "disable"
+	Document    = "file"
+	Enable      = "enable"
+	Expect      = "expect"
+	Include     = "include"
+	Input       = "input"
+	Item        = "item"
+	From        = "from"
+	Group       = "group"
+	Level       = "level"
+	Match       = "match"
+	Matches     = "matches"
+	Max         = "max"
+	Min         = "min"
+	Mult        = "mult"
+	Name        = "name"
+	Nodes       = "nodes"
+	Names       = "names"
+	Operation   = "operation"
+	Output      = "output"
+	OutputCount = "output-count"
+	Path        = "path"
+	Prec        = "precision"
+	Prefix      = "prefix"
+	Profiles    = "profiles"
+	Regex       = "regex"
+	Round       = "round"
+	Set         = "set"
+	Suffix      = "suffix"
+	Tags        = "tags"
+	Tests       = "tests"
+	Tier        = "tier"
+	Tiers       = "tiers"
+	Type        = "type"
+	Value       = "value"
+	Vars        = "vars"
 
-	MatchTag   = "tag"
-	MatchAttr  = "attr"
-	MatchAllOf = "all-of"
-	MatchAnyOf = "any-of"
-	MatchOneOf = "one-of"
-	MatchNot   = "not"
+	MatchTag           = "tag"
+	MatchAttr          = "attr"
+	MatchAllOf         = "all-of"
+	MatchAnyOf         = "any-of"
+	MatchOneOf         = "one-of"
+	MatchNot           = "not"
+	MatchPassiveEffect = "passive-effect"
 
-	ActionNumber        = "update-number"
-	ActionInsertAttr    = "insert-attr"
-	ActionInsertElement = "insert-element"
-	ActionRemoveAttr    = "remove-attr"
-	ActionRemoveElement = "remove-element"
+	ActionNumber             = "update-number"
+	ActionAppendText         = "append-text"
+	ActionCloneElement       = "clone-element"
+	ActionCopyFrom           = "copy-from"
+	ActionInsertAttr         = "insert-attr"
+	ActionInsertElement      = "insert-element"
+	ActionRemoveAttr         = "remove-attr"
+	ActionRemoveElement      = "remove-element"
+	ActionScaleLoot          = "scale-loot"
+	ActionScaleRecipe        = "scale-recipe"
+	ActionScalePassiveEffect = "scale-passive-effect"
+	ActionAddPassiveEffect   = "add-passive-effect"
 )
 
 var (
+	ConfigKeys = []string{
+		Include, Nodes, Profiles, Tests, Vars,
+	}
 	MatchTypes = []string{
-		MatchTag, MatchAttr, MatchAllOf, MatchAnyOf, MatchOneOf, MatchNot,
+		MatchTag, MatchAttr, MatchAllOf, MatchAnyOf, MatchOneOf, MatchNot, MatchPassiveEffect,
 	}
 	ActionTypes = []string{
-		ActionNumber, ActionInsertAttr, ActionInsertElement, ActionRemoveAttr, ActionRemoveElement,
+		ActionNumber, ActionAppendText, ActionCloneElement, ActionCopyFrom, ActionInsertAttr, ActionInsertElement,
+		ActionRemoveAttr, ActionRemoveElement, ActionScaleLoot, ActionScaleRecipe, ActionScalePassiveEffect,
+		ActionAddPassiveEffect,
 	}
 )
@@ -0,0 +1,319 @@
+package load
+
+import (
+	"bytes"
+	"encoding/json"
+	goerrors "errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tvarney/maputil/mpath"
+	"github.com/tvarney/sdtdmod/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the syntax of a configuration file.
+type Format int
+
+const (
+	// FormatJSON is JSON, optionally with `//` and `/* */` comments.
+	FormatJSON Format = iota
+	// FormatYAML is YAML.
+	FormatYAML
+)
+
+// FormatOf returns the format of a configuration file based on its
+// extension.
+//
+// Files with an unknown extension are treated as JSON.
+func FormatOf(filename string) Format {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	}
+	return FormatJSON
+}
+
+// IsConfigFile checks if a filename has the extension of a configuration
+// file.
+func IsConfigFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json", ".jsonc", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// decode parses the data of a file into JSON compatible values, recording the
+// source position of values in positions.
+func decode(filename string, data []byte, positions *errors.Positions) (interface{}, error) {
+	switch FormatOf(filename) {
+	case FormatYAML:
+		return decodeYAML(filename, data, positions)
+	}
+
+	return decodeJSON(filename, data, positions)
+}
+
+func decodeJSON(filename string, data []byte, positions *errors.Positions) (interface{}, error) {
+	data = StripComments(data)
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		var serr *json.SyntaxError
+		if goerrors.As(err, &serr) {
+			offset := int(serr.Offset) - 1
+			if offset < 0 {
+				offset = 0
+			}
+			return nil, &errors.PositionError{Filename: filename, Position: offsetPosition(data, offset), Err: err}
+		}
+		return nil, err
+	}
+
+	s := &jsonScanner{
+		dec:       json.NewDecoder(bytes.NewReader(data)),
+		data:      data,
+		positions: positions,
+	}
+	path := mpath.New(mpath.DotNotation{})
+	path.Filename = filename
+	if err := s.value(path, true); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// jsonScanner records the position of every value of a JSON document.
+//
+// The position of an object member is that of its key.
+type jsonScanner struct {
+	dec       *json.Decoder
+	data      []byte
+	positions *errors.Positions
+}
+
+// next returns the offset of the start of the next token.
+func (s *jsonScanner) next() int {
+	offset := int(s.dec.InputOffset())
+	for offset < len(s.data) {
+		switch s.data[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+			continue
+		}
+		break
+	}
+	return offset
+}
+
+func (s *jsonScanner) set(path *mpath.Path, offset int) {
+	s.positions.Set(path.Filename, path, offsetPosition(s.data, offset))
+}
+
+func (s *jsonScanner) value(path *mpath.Path, record bool) error {
+	if record {
+		s.set(path, s.next())
+	}
+	tok, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok {
+	case json.Delim('{'):
+		for s.dec.More() {
+			offset := s.next()
+			k, err := s.dec.Token()
+			if err != nil {
+				return err
+			}
+			name, _ := k.(string)
+			path.Add(mpath.Key(name))
+			s.set(path, offset)
+			err = s.value(path, false)
+			path.Pop()
+			if err != nil {
+				return err
+			}
+		}
+		_, err = s.dec.Token()
+	case json.Delim('['):
+		for idx := 0; s.dec.More(); idx++ {
+			path.Add(mpath.Index(idx))
+			err = s.value(path, true)
+			path.Pop()
+			if err != nil {
+				return err
+			}
+		}
+		_, err = s.dec.Token()
+	}
+	return err
+}
+
+// offsetPosition returns the line and column of a byte offset in data.
+//
+// Columns count characters rather than bytes.
+func offsetPosition(data []byte, offset int) errors.Position {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	line := bytes.Count(data[:offset], []byte("\n")) + 1
+	start := bytes.LastIndexByte(data[:offset], '\n') + 1
+	return errors.Position{Line: line, Column: utf8.RuneCount(data[start:offset]) + 1}
+}
+
+// StripComments replaces `//` and `/* */` comments outside of JSON strings
+// with spaces.
+//
+// Newlines are kept so the line and column of everything else is unchanged.
+func StripComments(data []byte) []byte {
+	if !bytes.Contains(data, []byte("/")) {
+		return data
+	}
+
+	out := make([]byte, len(data))
+	copy(out, data)
+	inString := false
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		switch {
+		case inString:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			out[i], out[i+1] = ' ', ' '
+			for i += 2; i < len(out); i++ {
+				if out[i] == '*' && i+1 < len(out) && out[i+1] == '/' {
+					out[i], out[i+1] = ' ', ' '
+					i++
+					break
+				}
+				if out[i] != '\n' && out[i] != '\r' {
+					out[i] = ' '
+				}
+			}
+		}
+	}
+	return out
+}
+
+func decodeYAML(filename string, data []byte, positions *errors.Positions) (interface{}, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, fmt.Errorf("empty YAML document")
+	}
+	path := mpath.New(mpath.DotNotation{})
+	path.Filename = filename
+	return convertYAML(doc.Content[0], path, positions)
+}
+
+// convertYAML converts a YAML node to JSON compatible values.
+//
+// The position of each value is recorded, except that the position of a
+// mapping member is that of its key, as it is for JSON.
+func convertYAML(n *yaml.Node, path *mpath.Path, positions *errors.Positions) (interface{}, error) {
+	positions.Set(path.Filename, path, errors.Position{Line: n.Line, Column: n.Column})
+	switch n.Kind {
+	case yaml.AliasNode:
+		return convertYAML(n.Alias, path, positions)
+	case yaml.SequenceNode:
+		arr := make([]interface{}, 0, len(n.Content))
+		for idx, child := range n.Content {
+			path.Add(mpath.Index(idx))
+			v, err := convertYAML(child, path, positions)
+			path.Pop()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case yaml.MappingNode:
+		obj := make(map[string]interface{}, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, child := n.Content[i], n.Content[i+1]
+			if k.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: mapping keys must be strings", k.Line)
+			}
+			if k.Value == "<<" && k.Tag == "!!merge" {
+				if err := mergeYAML(obj, child, path, positions); err != nil {
+					return nil, err
+				}
+				// Merging records the position of the merged mapping.
+				positions.Set(path.Filename, path, errors.Position{Line: n.Line, Column: n.Column})
+				continue
+			}
+			path.Add(mpath.Key(k.Value))
+			v, err := convertYAML(child, path, positions)
+			positions.Set(path.Filename, path, errors.Position{Line: k.Line, Column: k.Column})
+			path.Pop()
+			if err != nil {
+				return nil, err
+			}
+			obj[k.Value] = v
+		}
+		return obj, nil
+	case yaml.ScalarNode:
+		return convertYAMLScalar(n)
+	}
+	return nil, fmt.Errorf("line %d: unsupported YAML node", n.Line)
+}
+
+// mergeYAML handles the `<<` merge key by copying the keys of the merged
+// mappings which the mapping does not already define.
+func mergeYAML(obj map[string]interface{}, n *yaml.Node, path *mpath.Path, positions *errors.Positions) error {
+	sources := []*yaml.Node{n}
+	if n.Kind == yaml.SequenceNode {
+		sources = n.Content
+	}
+	for _, src := range sources {
+		v, err := convertYAML(src, path, positions)
+		if err != nil {
+			return err
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("line %d: merge value must be a mapping", src.Line)
+		}
+		for k, item := range m {
+			if _, exists := obj[k]; !exists {
+				obj[k] = item
+			}
+		}
+	}
+	return nil
+}
+
+func convertYAMLScalar(n *yaml.Node) (interface{}, error) {
+	switch n.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var b bool
+		if err := n.Decode(&b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	case "!!int", "!!float":
+		var f float64
+		if err := n.Decode(&f); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	return n.Value, nil
+}
@@ -0,0 +1,37 @@
+package load
+
+import (
+	"testing"
+
+	"github.com/tvarney/maputil/mpath"
+	"github.com/tvarney/sdtdmod/pkg/errors"
+)
+
+// TestPositions checks that the position of a member of an object or mapping
+// is that of its key in both formats.
+func TestPositions(t *testing.T) {
+	files := map[string]string{
+		"c.json": "[{\"actions\": [\n  {\"type\": \"update-number\",\n   \"mutl\": 2}]}]",
+		"c.yaml": "- actions:\n    - type: update-number\n      mutl: 2\n",
+	}
+	want := map[string]errors.Position{
+		"c.json": {Line: 3, Column: 4},
+		"c.yaml": {Line: 3, Column: 7},
+	}
+	for name, data := range files {
+		positions := errors.NewPositions()
+		if _, err := decode(name, []byte(data), positions); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		path := mpath.New(mpath.DotNotation{})
+		path.Filename = name
+		path.Add(mpath.Index(0))
+		path.Add(mpath.Key("actions"))
+		path.Add(mpath.Index(0))
+		path.Add(mpath.Key("mutl"))
+		got, ok := positions.Lookup(path)
+		if !ok || got != want[name] {
+			t.Errorf("%s: position is %v, expected %v", name, got, want[name])
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package impl
 
 import (
+	"fmt"
 	"math"
 
 	"github.com/tvarney/maputil"
@@ -32,6 +33,7 @@ func UnpackActionList(ctx *errctx.Context, raw []interface{}) []node.Action {
 		if action != nil {
 			actions = append(actions, action)
 		}
+		ctx.Path.Pop()
 	}
 
 	if len(actions) == 0 {
@@ -40,31 +42,31 @@ func UnpackActionList(ctx *errctx.Context, raw []interface{}) []node.Action {
 	return actions
 }
 
-// UnpackAction takes a JSON object and unpacks it to an Action.
+// UnpackAction takes a JSON object and unpacks it to an Action using the spec
+// registered for its type.
 func UnpackAction(ctx *errctx.Context, action map[string]interface{}) node.Action {
 	atype := unpack.RequireStringEnum(ctx, action, key.Type, key.ActionTypes)
-	switch atype {
-	case key.ActionNumber:
-		return UnpackActionNumber(ctx, action)
-	case key.ActionInsertAttr:
-		return UnpackActionInsertAttr(ctx, action)
-	case key.ActionInsertElement:
-		return UnpackActionInsertElement(ctx, action)
-	case key.ActionRemoveAttr:
-		return UnpackActionRemoveAttr(ctx, action)
-	case key.ActionRemoveElement:
-		return UnpackActionRemoveElement(ctx, action)
+	if spec, ok := ActionSpecs[atype]; ok {
+		return spec.Unpack(ctx, action)
 	}
 	return nil
 }
 
 // UnpackActionNumber takes a JSON object and unpacks it to a Number Action.
 func UnpackActionNumber(ctx *errctx.Context, action map[string]interface{}) node.Action {
-	attr := unpack.RequireString(ctx, action, key.Attr)
-	if attr == "" {
+	attr, attrs, ok := UnpackAttrTarget(ctx, action, key.Attr)
+	if !ok {
 		return nil
 	}
 
+	n := unpackNumber(ctx, action, attr)
+	n.Attrs = attrs
+	n.If = UnpackCondition(ctx, action)
+	return n
+}
+
+// unpackNumber reads the numeric operation keys of an action.
+func unpackNumber(ctx *errctx.Context, action map[string]interface{}, attr string) *node.Number {
 	return &node.Number{
 		Attribute: attr,
 		Mult:      unpack.OptionalNumber(ctx, action, key.Mult, 1.0),
@@ -72,22 +74,114 @@ func UnpackActionNumber(ctx *errctx.Context, action map[string]interface{}) node
 		Min:       unpack.OptionalNumber(ctx, action, key.Min, -math.MaxFloat64),
 		Max:       unpack.OptionalNumber(ctx, action, key.Max, math.MaxFloat64),
 		Precision: int(unpack.OptionalInteger(ctx, action, key.Prec, -1)),
+	}
+}
+
+// UnpackActionAppendText takes a JSON object and unpacks it to an AppendText
+// Action.
+func UnpackActionAppendText(ctx *errctx.Context, action map[string]interface{}) node.Action {
+	errs := ctx.ErrorCount()
+	attribute, attrs, ok := UnpackAttrTarget(ctx, action, key.Name)
+	value := unpack.RequireString(ctx, action, key.Value)
+	if !ok || ctx.ErrorCount() != errs {
+		return nil
+	}
+
+	return &node.AppendText{
+		Attribute: attribute,
+		Attrs:     attrs,
+		Value:     value,
 		If:        UnpackCondition(ctx, action),
 	}
 }
 
+// UnpackActionCloneElement takes a JSON object and unpacks it to a
+// CloneElement Action.
+func UnpackActionCloneElement(ctx *errctx.Context, action map[string]interface{}) node.Action {
+	errs := ctx.ErrorCount()
+	raw := unpack.RequireObject(ctx, action, key.Set)
+	if ctx.ErrorCount() != errs {
+		return nil
+	}
+	if len(raw) == 0 {
+		ctx.ErrorWithKey(fmt.Errorf("clone-element requires at least one attribute to set"), key.Set)
+		return nil
+	}
+
+	set := make(map[string]string, len(raw))
+	ctx.Path.Add(mpath.Key(key.Set))
+	for name, v := range raw {
+		value, ok := v.(string)
+		if !ok {
+			ctx.ErrorWithKey(maputil.InvalidTypeError{
+				Expected: []string{maputil.TypeString},
+				Actual:   maputil.TypeName(v),
+			}, name)
+			continue
+		}
+		set[name] = value
+	}
+	ctx.Path.Pop()
+	if ctx.ErrorCount() != errs {
+		return nil
+	}
+
+	return &node.CloneElement{
+		Set: set,
+		If:  UnpackCondition(ctx, action),
+	}
+}
+
+// UnpackActionCopyFrom takes a JSON object and unpacks it to a CopyFrom
+// Action.
+func UnpackActionCopyFrom(ctx *errctx.Context, action map[string]interface{}) node.Action {
+	errs := ctx.ErrorCount()
+	attr := unpack.RequireString(ctx, action, key.Attr)
+	path := UnpackPath(ctx, action)
+	var source node.Match
+	if rawSource := unpack.OptionalObject(ctx, action, key.Match, nil); rawSource != nil {
+		ctx.Path.Add(mpath.Key(key.Match))
+		source = UnpackMatch(ctx, rawSource)
+		ctx.Path.Pop()
+	}
+	if ctx.ErrorCount() != errs {
+		return nil
+	}
+	if path == "" && source == nil {
+		ctx.Error(fmt.Errorf("copy-from requires at least one of %q or %q", key.Path, key.Match))
+		return nil
+	}
+
+	c := &node.CopyFrom{
+		Attribute: attr,
+		Path:      path,
+		Document:  unpack.OptionalString(ctx, action, key.Document, ""),
+		Source:    source,
+		From:      unpack.OptionalString(ctx, action, key.From, key.Value),
+		If:        UnpackCondition(ctx, action),
+	}
+	for _, k := range []string{key.Mult, key.Add, key.Min, key.Max, key.Prec} {
+		if _, ok := action[k]; ok {
+			c.Transform = unpackNumber(ctx, action, attr)
+			break
+		}
+	}
+	return c
+}
+
 // UnpackActionInsertAttr takes a JSON object and unpacks it to an InsertAttr
 // Action.
 func UnpackActionInsertAttr(ctx *errctx.Context, action map[string]interface{}) node.Action {
 	errs := ctx.ErrorCount()
-	attribute := unpack.RequireString(ctx, action, key.Name)
+	attribute, attrs, ok := UnpackAttrTarget(ctx, action, key.Name)
 	value := unpack.RequireString(ctx, action, key.Value)
-	if ctx.ErrorCount() != errs {
+	if !ok || ctx.ErrorCount() != errs {
 		return nil
 	}
 
 	return &node.InsertAttr{
 		Attribute: attribute,
+		Attrs:     attrs,
 		Value:     value,
 		If:        UnpackCondition(ctx, action),
 	}
@@ -102,14 +196,14 @@ func UnpackActionInsertElement(ctx *errctx.Context, action map[string]interface{
 // UnpackActionRemoveAttr takes a JSON object and unpacks it to a RemoveAttr
 // Action.
 func UnpackActionRemoveAttr(ctx *errctx.Context, action map[string]interface{}) node.Action {
-	errs := ctx.ErrorCount()
-	attribute := unpack.RequireString(ctx, action, key.Name)
-	if ctx.ErrorCount() != errs {
+	attribute, attrs, ok := UnpackAttrTarget(ctx, action, key.Name)
+	if !ok {
 		return nil
 	}
 
 	return &node.RemoveAttr{
 		Attribute: attribute,
+		Attrs:     attrs,
 		If:        UnpackCondition(ctx, action),
 	}
 }
@@ -119,3 +213,111 @@ func UnpackActionRemoveAttr(ctx *errctx.Context, action map[string]interface{})
 func UnpackActionRemoveElement(ctx *errctx.Context, action map[string]interface{}) node.Action {
 	return nil
 }
+
+// UnpackActionScaleLoot takes a JSON object and unpacks it to a ScaleLoot
+// Action.
+func UnpackActionScaleLoot(ctx *errctx.Context, action map[string]interface{}) node.Action {
+	errs := ctx.ErrorCount()
+	item := unpack.OptionalString(ctx, action, key.Item, "")
+	group := unpack.OptionalString(ctx, action, key.Group, "")
+	mult := unpack.RequireNumber(ctx, action, key.Mult)
+	if ctx.ErrorCount() != errs {
+		return nil
+	}
+	if item == "" && group == "" {
+		ctx.Error(fmt.Errorf("scale-loot requires at least one of %q or %q", key.Item, key.Group))
+		return nil
+	}
+	if mult < 0 {
+		ctx.ErrorWithKey(fmt.Errorf("%q must not be negative", key.Mult), key.Mult)
+		return nil
+	}
+
+	return &node.ScaleLoot{
+		Item:  item,
+		Group: group,
+		Mult:  mult,
+		Level: unpack.OptionalNumber(ctx, action, key.Level, 1),
+		If:    UnpackCondition(ctx, action),
+	}
+}
+
+// UnpackActionScaleRecipe takes a JSON object and unpacks it to a ScaleRecipe
+// Action.
+func UnpackActionScaleRecipe(ctx *errctx.Context, action map[string]interface{}) node.Action {
+	errs := ctx.ErrorCount()
+	s := node.NewScaleRecipe()
+	s.Names = unpack.OptionalStringArray(ctx, action, key.Names)
+	s.Tags = unpack.OptionalStringArray(ctx, action, key.Tags)
+	s.Mult = unpack.OptionalNumber(ctx, action, key.Mult, 1)
+	s.Round = unpack.OptionalStringEnum(ctx, action, key.Round, node.RoundingModes, node.RoundNearest)
+	s.Min = int(unpack.OptionalInteger(ctx, action, key.Min, 1))
+	s.Output = unpack.OptionalNumber(ctx, action, key.OutputCount, 1)
+	if _, ok := action[key.CraftTime]; ok {
+		s.Time = node.NewNumber(node.RecipeTime)
+		s.Time.Mult = unpack.OptionalNumber(ctx, action, key.CraftTime, 1)
+		s.Time.Precision = 2
+	}
+	if ctx.ErrorCount() != errs {
+		return nil
+	}
+	for _, k := range []string{key.Mult, key.OutputCount, key.CraftTime} {
+		if v, ok := action[k].(float64); ok && v < 0 {
+			ctx.ErrorWithKey(fmt.Errorf("%q must not be negative", k), k)
+		}
+	}
+	if s.Min < 0 {
+		ctx.ErrorWithKey(fmt.Errorf("%q must not be negative", key.Min), key.Min)
+	}
+	if ctx.ErrorCount() != errs {
+		return nil
+	}
+
+	s.If = UnpackCondition(ctx, action)
+	return s
+}
+
+// UnpackActionScalePassiveEffect takes a JSON object and unpacks it to a
+// ScalePassiveEffect Action.
+func UnpackActionScalePassiveEffect(ctx *errctx.Context, action map[string]interface{}) node.Action {
+	errs := ctx.ErrorCount()
+	n := unpackNumber(ctx, action, node.EffectValue)
+	raw := unpack.OptionalIntegerArray(ctx, action, key.Tiers)
+	if ctx.ErrorCount() != errs {
+		return nil
+	}
+
+	if _, ok := action[key.Prec]; !ok {
+		// Effect values are fractions such as 0.15, which multiplying turns
+		// into values like 0.15000000000000002 unless they are rounded.
+		n.Precision = 6
+	}
+	tiers := make([]int, 0, len(raw))
+	for _, t := range raw {
+		tiers = append(tiers, int(t))
+	}
+	return &node.ScalePassiveEffect{
+		Number: n,
+		Tiers:  tiers,
+		If:     UnpackCondition(ctx, action),
+	}
+}
+
+// UnpackActionAddPassiveEffect takes a JSON object and unpacks it to an
+// AddPassiveEffect Action.
+func UnpackActionAddPassiveEffect(ctx *errctx.Context, action map[string]interface{}) node.Action {
+	errs := ctx.ErrorCount()
+	a := &node.AddPassiveEffect{
+		Name:      unpack.RequireString(ctx, action, key.Name),
+		Operation: unpack.RequireString(ctx, action, key.Operation),
+		Value:     unpack.RequireString(ctx, action, key.Value),
+		Tier:      unpack.OptionalString(ctx, action, key.Tier, ""),
+		Tags:      unpack.OptionalStringArray(ctx, action, key.Tags),
+	}
+	if ctx.ErrorCount() != errs {
+		return nil
+	}
+
+	a.If = UnpackCondition(ctx, action)
+	return a
+}
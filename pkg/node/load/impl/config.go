@@ -0,0 +1,182 @@
+package impl
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tvarney/maputil"
+	"github.com/tvarney/maputil/errctx"
+	"github.com/tvarney/maputil/mpath"
+	"github.com/tvarney/maputil/unpack"
+	"github.com/tvarney/sdtdmod/pkg/node"
+	"github.com/tvarney/sdtdmod/pkg/node/key"
+)
+
+// IsConfigObject checks if a top level JSON object is a config object rather
+// than a single node.
+func IsConfigObject(obj map[string]interface{}) bool {
+	for _, k := range key.ConfigKeys {
+		if _, ok := obj[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// IncludeFunc loads an included configuration and returns its nodes.
+type IncludeFunc func(ctx *errctx.Context, path string) []*node.Node
+
+// ConfigState holds the state shared by a configuration file and the files it
+// includes.
+type ConfigState struct {
+	// Overrides replaces the values of declared variables.
+	Overrides map[string]string
+	// Vars holds every variable declared so far.
+	Vars map[string]interface{}
+	// Profiles holds every profile declared so far.
+	Profiles map[string]*node.Profile
+	// Profile is the name of the selected profile, if any.
+	Profile string
+	// Selected is the selected profile if it was found before unpacking, so
+	// that its variables apply even if it is declared in a file loaded after
+	// the variables it sets. Otherwise the profile is looked up in Profiles
+	// as variables are declared.
+	Selected *node.Profile
+	// Lenient reports unexpected keys as warnings instead of errors.
+	Lenient bool
+	// Lint runs the lint checks on nodes before unpacking them.
+	Lint bool
+	// Include is called to load included files.
+	Include IncludeFunc
+	// Tests holds every test case declared so far.
+	Tests []*node.Test
+}
+
+// NewConfigState returns an empty config state.
+func NewConfigState(overrides map[string]string, profile string, include IncludeFunc) *ConfigState {
+	return &ConfigState{
+		Overrides: overrides,
+		Vars:      map[string]interface{}{},
+		Profiles:  map[string]*node.Profile{},
+		Profile:   profile,
+		Include:   include,
+	}
+}
+
+// UnpackConfig takes the top level value of a configuration file and unpacks
+// the nodes it contains.
+//
+// The value may be a list of nodes, a single node, or a config object. A
+// config object is processed in order: its profiles and variables are added
+// to the state, then each path listed in the 'include' key is passed to the
+// include function, and finally its own nodes and tests are unpacked after
+// resolving references to variables. Tests are added to the state. The nodes
+// of included files precede those of the object.
+//
+// Keys which are not used by any unpack function are reported before
+// unpacking.
+func UnpackConfig(ctx *errctx.Context, value interface{}, state *ConfigState) []*node.Node {
+	CheckConfigKeys(ctx, value, state.Lenient)
+	switch v := value.(type) {
+	case []interface{}:
+		return unpackNodes(ctx, v, state)
+	case map[string]interface{}:
+		if !IsConfigObject(v) {
+			resolved := ResolveVars(ctx, v, state.Vars).(map[string]interface{})
+			if state.Lint {
+				LintNode(ctx, resolved)
+			}
+			n := UnpackNode(ctx, resolved)
+			if n == nil {
+				return nil
+			}
+			return []*node.Node{n}
+		}
+
+		if rawProfiles := unpack.OptionalObject(ctx, v, key.Profiles, nil); rawProfiles != nil {
+			ctx.Path.Add(mpath.Key(key.Profiles))
+			UnpackProfiles(ctx, rawProfiles, state.Profiles)
+			ctx.Path.Pop()
+		}
+		if rawVars := unpack.OptionalObject(ctx, v, key.Vars, nil); rawVars != nil {
+			ctx.Path.Add(mpath.Key(key.Vars))
+			UnpackVars(ctx, rawVars, state)
+			ctx.Path.Pop()
+		}
+		var nodes []*node.Node
+		includes := unpack.OptionalStringArray(ctx, v, key.Include)
+		if len(includes) > 0 {
+			ctx.Path.Add(mpath.Key(key.Include))
+			for idx, path := range includes {
+				ctx.Path.Add(mpath.Index(idx))
+				nodes = append(nodes, state.Include(ctx, path)...)
+				ctx.Path.Pop()
+			}
+			ctx.Path.Pop()
+		}
+
+		rawNodes := unpack.OptionalArray(ctx, v, key.Nodes, nil)
+		if rawNodes != nil {
+			ctx.Path.Add(mpath.Key(key.Nodes))
+			nodes = append(nodes, unpackNodes(ctx, rawNodes, state)...)
+			ctx.Path.Pop()
+		}
+		if rawTests := unpack.OptionalArray(ctx, v, key.Tests, nil); rawTests != nil {
+			ctx.Path.Add(mpath.Key(key.Tests))
+			resolved := ResolveVars(ctx, rawTests, state.Vars).([]interface{})
+			state.Tests = append(state.Tests, UnpackTestList(ctx, resolved)...)
+			ctx.Path.Pop()
+		}
+		if len(nodes) == 0 {
+			return nil
+		}
+		return nodes
+	}
+
+	ctx.Error(maputil.InvalidTypeError{
+		Expected: []string{maputil.TypeArray, maputil.TypeObject},
+		Actual:   maputil.TypeName(value),
+	})
+	return nil
+}
+
+// unpackNodes resolves variables in a list of nodes, lints them if enabled,
+// and unpacks them.
+func unpackNodes(ctx *errctx.Context, raw []interface{}, state *ConfigState) []*node.Node {
+	resolved := ResolveVars(ctx, raw, state.Vars).([]interface{})
+	if state.Lint {
+		LintNodeList(ctx, resolved)
+	}
+	return UnpackNodeList(ctx, resolved)
+}
+
+// UnpackProfiles takes the JSON object of a 'profiles' block and adds each
+// profile to profiles.
+func UnpackProfiles(ctx *errctx.Context, raw map[string]interface{}, profiles map[string]*node.Profile) {
+	names := maputil.Keys(raw)
+	sort.Strings(names)
+	for _, name := range names {
+		ctx.Path.Add(mpath.Key(name))
+		if _, exists := profiles[name]; exists {
+			ctx.Error(fmt.Errorf("profile %q is already defined", name))
+			ctx.Path.Pop()
+			continue
+		}
+		obj, err := maputil.AsObject(raw[name])
+		if err != nil {
+			ctx.Error(err)
+			ctx.Path.Pop()
+			continue
+		}
+
+		p := &node.Profile{
+			Name:        name,
+			Description: unpack.OptionalString(ctx, obj, key.Description, ""),
+			Enable:      unpack.OptionalStringArray(ctx, obj, key.Enable),
+			Disable:     unpack.OptionalStringArray(ctx, obj, key.Disable),
+			Vars:        unpack.OptionalObject(ctx, obj, key.Vars, nil),
+		}
+		profiles[name] = p
+		ctx.Path.Pop()
+	}
+}
@@ -0,0 +1,227 @@
+package impl
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/tvarney/maputil"
+	"github.com/tvarney/maputil/errctx"
+	"github.com/tvarney/maputil/mpath"
+	"github.com/tvarney/sdtdmod/pkg/errors"
+	"github.com/tvarney/sdtdmod/pkg/node/key"
+)
+
+// ExtensionPrefix marks keys which are ignored by the loader, such as keys
+// used to hold YAML anchors.
+const ExtensionPrefix = "x-"
+
+// Report reports an error with the given severity.
+//
+// Only errors with SeverityError count towards the error count of the context.
+func Report(ctx *errctx.Context, severity errors.Severity, err error) {
+	d := &errors.Diagnostic{Severity: severity, Err: err}
+	if severity == errors.SeverityError {
+		ctx.Error(d)
+		return
+	}
+	if ctx.Handler != nil {
+		ctx.Handler.Add(ctx.Path, d)
+	}
+}
+
+// Warn reports an error as a warning, which does not count towards the error
+// count of the context.
+func Warn(ctx *errctx.Context, err error) {
+	Report(ctx, errors.SeverityWarning, err)
+}
+
+// CheckConfigKeys reports every key of a configuration which no unpack
+// function uses.
+//
+// The keys each function uses are those of the spec registered for it, so
+// every object is checked against its spec. Unexpected keys are errors, or
+// warnings if lenient is set.
+func CheckConfigKeys(ctx *errctx.Context, value interface{}, lenient bool) {
+	c := keyChecker{ctx: ctx, lenient: lenient}
+	switch v := value.(type) {
+	case []interface{}:
+		c.check(v, KindNodeList)
+	case map[string]interface{}:
+		if IsConfigObject(v) {
+			c.object(v, ConfigSpec, false)
+		} else {
+			c.object(v, NodeSpec, false)
+		}
+	}
+}
+
+// CheckMatchKeys reports every key of a match which no unpack function uses.
+func CheckMatchKeys(ctx *errctx.Context, value interface{}, lenient bool) {
+	c := keyChecker{ctx: ctx, lenient: lenient}
+	c.check(value, KindMatch)
+}
+
+// CheckActionKeys reports every key of an action which no unpack function
+// uses.
+func CheckActionKeys(ctx *errctx.Context, value interface{}, lenient bool) {
+	c := keyChecker{ctx: ctx, lenient: lenient}
+	if obj, ok := value.(map[string]interface{}); ok {
+		c.typed(obj, key.ActionTypes, func(t string) *Spec { return &ActionSpecs[t].Spec })
+	}
+}
+
+type keyChecker struct {
+	ctx     *errctx.Context
+	lenient bool
+}
+
+// check descends into a value of the given kind.
+func (c *keyChecker) check(value interface{}, kind FieldKind) {
+	switch kind {
+	case KindMatch:
+		if obj, ok := value.(map[string]interface{}); ok {
+			c.typed(obj, key.MatchTypes, func(t string) *Spec { return &MatchSpecs[t].Spec })
+		}
+	case KindMatchList, KindActionList, KindNodeList:
+		arr, ok := value.([]interface{})
+		if !ok {
+			return
+		}
+		for idx, item := range arr {
+			c.ctx.Path.Add(mpath.Index(idx))
+			switch kind {
+			case KindMatchList:
+				c.check(item, KindMatch)
+			case KindActionList:
+				if obj, ok := item.(map[string]interface{}); ok {
+					c.typed(obj, key.ActionTypes, func(t string) *Spec { return &ActionSpecs[t].Spec })
+				}
+			case KindNodeList:
+				if obj, ok := item.(map[string]interface{}); ok {
+					c.object(obj, NodeSpec, false)
+				}
+			}
+			c.ctx.Path.Pop()
+		}
+	case KindAttrs:
+		if obj, ok := value.(map[string]interface{}); ok {
+			c.object(obj, AttrSelectorSpec, false)
+		}
+	case KindTestList, KindExpectList:
+		arr, ok := value.([]interface{})
+		if !ok {
+			return
+		}
+		spec := TestSpec
+		if kind == KindExpectList {
+			spec = ExpectSpec
+		}
+		for idx, item := range arr {
+			if obj, ok := item.(map[string]interface{}); ok {
+				c.ctx.Path.Add(mpath.Index(idx))
+				c.object(obj, spec, false)
+				c.ctx.Path.Pop()
+			}
+		}
+	case KindProfiles:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for _, name := range sortedKeys(obj) {
+			if profile, ok := obj[name].(map[string]interface{}); ok {
+				c.ctx.Path.Add(mpath.Key(name))
+				c.object(profile, ProfileSpec, false)
+				c.ctx.Path.Pop()
+			}
+		}
+	}
+}
+
+// typed checks an object whose spec is chosen by its 'type' key. Objects with
+// a missing or unknown type are skipped, as unpacking reports those.
+func (c *keyChecker) typed(obj map[string]interface{}, types []string, spec func(string) *Spec) {
+	t, ok := obj[key.Type].(string)
+	if !ok || maputil.CheckEnum(t, types) != nil {
+		return
+	}
+	c.object(obj, spec(t), true)
+}
+
+func (c *keyChecker) object(obj map[string]interface{}, spec *Spec, typed bool) {
+	valid := make([]string, 0, len(spec.Fields)+1)
+	if typed {
+		valid = append(valid, key.Type)
+	}
+	for _, f := range spec.Fields {
+		valid = append(valid, f.Name)
+	}
+
+	for _, k := range sortedKeys(obj) {
+		c.ctx.Path.Add(mpath.Key(k))
+		if f, ok := spec.Field(k); ok {
+			c.check(obj[k], f.Kind)
+		} else if !(typed && k == key.Type) && !strings.HasPrefix(k, ExtensionPrefix) {
+			err := errors.UnexpectedKeyError{Key: k, Suggestion: Closest(k, valid)}
+			if c.lenient {
+				Warn(c.ctx, err)
+			} else {
+				c.ctx.Error(err)
+			}
+		}
+		c.ctx.Path.Pop()
+	}
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := maputil.Keys(obj)
+	sort.Strings(keys)
+	return keys
+}
+
+// Closest returns the candidate most similar to s, or an empty string if none
+// are similar enough to be a likely typo.
+func Closest(s string, candidates []string) string {
+	best := ""
+	bestDist := len(s)/3 + 2
+	for _, c := range candidates {
+		if d := editDistance(s, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the number of insertions, deletions, substitutions, and
+// transpositions of adjacent characters needed to turn a into b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = minInt(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,274 @@
+package impl
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/tvarney/maputil/errctx"
+	"github.com/tvarney/maputil/mpath"
+	"github.com/tvarney/sdtdmod/pkg/errors"
+	"github.com/tvarney/sdtdmod/pkg/node/key"
+)
+
+// leafTags are the tags of game data elements which never have children.
+var leafTags = []string{"drop", "ingredient", "passive_effect", "requirement"}
+
+// LintNodeList checks a list of nodes for mistakes which do not prevent them
+// from being loaded.
+//
+// The list must already have its variables resolved. Problems are reported
+// with the severity given by Report; values which are invalid are skipped, as
+// unpacking reports those.
+func LintNodeList(ctx *errctx.Context, raw []interface{}) {
+	for idx, item := range raw {
+		if obj, ok := item.(map[string]interface{}); ok {
+			ctx.Path.Add(mpath.Index(idx))
+			LintNode(ctx, obj)
+			ctx.Path.Pop()
+		}
+	}
+}
+
+// LintNode checks a node, its match, its actions, and its children.
+func LintNode(ctx *errctx.Context, obj map[string]interface{}) {
+	match, _ := obj[key.Match].(map[string]interface{})
+	if match != nil {
+		ctx.Path.Add(mpath.Key(key.Match))
+		lintMatch(ctx, match)
+		ctx.Path.Pop()
+	}
+
+	if actions, ok := obj[key.Actions].([]interface{}); ok {
+		ctx.Path.Add(mpath.Key(key.Actions))
+		for idx, item := range actions {
+			if action, ok := item.(map[string]interface{}); ok {
+				ctx.Path.Add(mpath.Index(idx))
+				lintAction(ctx, action)
+				ctx.Path.Pop()
+			}
+		}
+		ctx.Path.Pop()
+	}
+
+	if children, ok := obj[key.Children].([]interface{}); ok && len(children) > 0 {
+		ctx.Path.Add(mpath.Key(key.Children))
+		if match != nil && (neverMatches(match) || leafOnly(match)) {
+			Report(ctx, errors.SeverityWarning, fmt.Errorf("children are never applied, as the elements matched by the node have no children"))
+		}
+		LintNodeList(ctx, children)
+		ctx.Path.Pop()
+	}
+}
+
+func lintMatch(ctx *errctx.Context, match map[string]interface{}) {
+	mtype, _ := match[key.Type].(string)
+	switch mtype {
+	case key.MatchTag, key.MatchAttr:
+		lintConstraints(ctx, match)
+	case key.MatchAllOf, key.MatchAnyOf, key.MatchOneOf:
+		matches, ok := match[key.Matches].([]interface{})
+		if !ok {
+			return
+		}
+		switch len(matches) {
+		case 0:
+			Report(ctx, errors.SeverityWarning, fmt.Errorf("%s without sub-matches", mtype))
+		case 1:
+			Report(ctx, errors.SeverityInfo, fmt.Errorf("%s with a single sub-match may be replaced by the sub-match", mtype))
+		}
+		ctx.Path.Add(mpath.Key(key.Matches))
+		for idx, item := range matches {
+			if sub, ok := item.(map[string]interface{}); ok {
+				ctx.Path.Add(mpath.Index(idx))
+				lintMatch(ctx, sub)
+				ctx.Path.Pop()
+			}
+		}
+		ctx.Path.Pop()
+	case key.MatchNot:
+		sub, ok := match[key.Match].(map[string]interface{})
+		if !ok {
+			return
+		}
+		if t, _ := sub[key.Type].(string); t == key.MatchNot {
+			Report(ctx, errors.SeverityWarning, fmt.Errorf("not of a not may be replaced by the inner match"))
+		}
+		ctx.Path.Add(mpath.Key(key.Match))
+		lintMatch(ctx, sub)
+		ctx.Path.Pop()
+	}
+}
+
+// lintConstraints checks the regex, prefix, and suffix of a tag or attr match
+// against its exact value, which makes them either redundant or impossible.
+func lintConstraints(ctx *errctx.Context, match map[string]interface{}) {
+	value, ok := match[key.Value].(string)
+	if !ok || value == "" {
+		return
+	}
+	for _, k := range []string{key.Regex, key.Prefix, key.Suffix} {
+		if _, ok := match[k].(string); !ok {
+			continue
+		}
+		ctx.Path.Add(mpath.Key(k))
+		if constraintHolds(match, k, value) {
+			Report(ctx, errors.SeverityInfo, fmt.Errorf("%q is redundant, as %q always satisfies it", k, value))
+		} else {
+			Report(ctx, errors.SeverityWarning, fmt.Errorf("the match never matches, as %q does not satisfy %q", value, k))
+		}
+		ctx.Path.Pop()
+	}
+}
+
+func lintAction(ctx *errctx.Context, action map[string]interface{}) {
+	atype, _ := action[key.Type].(string)
+	switch atype {
+	case key.ActionNumber:
+		if isNoop(action) {
+			Report(ctx, errors.SeverityWarning, fmt.Errorf("%s has no effect", atype))
+		}
+		lintRange(ctx, action)
+	case key.ActionCopyFrom:
+		lintRange(ctx, action)
+		if match, ok := action[key.Match].(map[string]interface{}); ok {
+			ctx.Path.Add(mpath.Key(key.Match))
+			lintMatch(ctx, match)
+			ctx.Path.Pop()
+		}
+	}
+	if cond, ok := action[key.Cond].(map[string]interface{}); ok {
+		ctx.Path.Add(mpath.Key(key.Cond))
+		lintMatch(ctx, cond)
+		ctx.Path.Pop()
+	}
+}
+
+// isNoop checks if the numeric keys of an action leave every value unchanged.
+func isNoop(action map[string]interface{}) bool {
+	if mult, ok := action[key.Mult].(float64); ok && mult != 1 {
+		return false
+	}
+	if add, ok := action[key.Add].(float64); ok && add != 0 {
+		return false
+	}
+	for _, k := range []string{key.Min, key.Max, key.Prec} {
+		if _, ok := action[k]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+func lintRange(ctx *errctx.Context, action map[string]interface{}) {
+	min, hasMin := action[key.Min].(float64)
+	max, hasMax := action[key.Max].(float64)
+	if hasMin && hasMax && min > max {
+		ctx.Path.Add(mpath.Key(key.Min))
+		Report(ctx, errors.SeverityError, fmt.Errorf("%q (%v) is greater than %q (%v)", key.Min, min, key.Max, max))
+		ctx.Path.Pop()
+	}
+}
+
+// neverMatches checks if a match can be shown to never match any element.
+func neverMatches(match map[string]interface{}) bool {
+	mtype, _ := match[key.Type].(string)
+	switch mtype {
+	case key.MatchTag, key.MatchAttr:
+		value, ok := match[key.Value].(string)
+		if !ok || value == "" {
+			return false
+		}
+		for _, k := range []string{key.Regex, key.Prefix, key.Suffix} {
+			if _, ok := match[k].(string); ok && !constraintHolds(match, k, value) {
+				return true
+			}
+		}
+	case key.MatchAllOf:
+		for _, sub := range subMatches(match) {
+			if neverMatches(sub) {
+				return true
+			}
+		}
+	case key.MatchAnyOf, key.MatchOneOf:
+		raw, _ := match[key.Matches].([]interface{})
+		subs := subMatches(match)
+		if len(subs) != len(raw) {
+			return false
+		}
+		for _, sub := range subs {
+			if !neverMatches(sub) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// leafOnly checks if a match only matches elements which never have children.
+func leafOnly(match map[string]interface{}) bool {
+	mtype, _ := match[key.Type].(string)
+	switch mtype {
+	case key.MatchTag:
+		value, _ := match[key.Value].(string)
+		return contains(leafTags, value)
+	case key.MatchPassiveEffect:
+		return true
+	case key.MatchAllOf:
+		for _, sub := range subMatches(match) {
+			if leafOnly(sub) {
+				return true
+			}
+		}
+	case key.MatchAnyOf, key.MatchOneOf:
+		subs := subMatches(match)
+		if len(subs) == 0 {
+			return false
+		}
+		for _, sub := range subs {
+			if !leafOnly(sub) && !neverMatches(sub) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// constraintHolds checks if the value satisfies the regex, prefix, or suffix
+// constraint of a match. Invalid regexes are treated as satisfied.
+func constraintHolds(match map[string]interface{}, k, value string) bool {
+	constraint, _ := match[k].(string)
+	switch k {
+	case key.Regex:
+		r, err := regexp.Compile(constraint)
+		return err != nil || r.MatchString(value)
+	case key.Prefix:
+		return strings.HasPrefix(value, constraint)
+	case key.Suffix:
+		return strings.HasSuffix(value, constraint)
+	}
+	return true
+}
+
+// subMatches returns the sub-matches of a match which are objects.
+func subMatches(match map[string]interface{}) []map[string]interface{} {
+	raw, _ := match[key.Matches].([]interface{})
+	subs := make([]map[string]interface{}, 0, len(raw))
+	for _, item := range raw {
+		if sub, ok := item.(map[string]interface{}); ok {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,8 @@
 package impl
 
 import (
+	"fmt"
+
 	"github.com/tvarney/maputil"
 	"github.com/tvarney/maputil/errctx"
 	"github.com/tvarney/maputil/mpath"
@@ -37,21 +39,13 @@ func UnpackMatchArray(ctx *errctx.Context, match map[string]interface{}) []node.
 	}
 	return matches
 }
+
+// UnpackMatch takes a JSON object and unpacks it to a Match using the spec
+// registered for its type.
 func UnpackMatch(ctx *errctx.Context, match map[string]interface{}) node.Match {
 	mtype := unpack.RequireStringEnum(ctx, match, key.Type, key.MatchTypes)
-	switch mtype {
-	case key.MatchTag:
-		return UnpackMatchTag(ctx, match)
-	case key.MatchAttr:
-		return UnpackMatchAttr(ctx, match)
-	case key.MatchAllOf:
-		return UnpackMatchAllOf(ctx, match)
-	case key.MatchAnyOf:
-		return UnpackMatchAnyOf(ctx, match)
-	case key.MatchOneOf:
-		return UnpackMatchOneOf(ctx, match)
-	case key.MatchNot:
-		return UnpackMatchNot(ctx, match)
+	if spec, ok := MatchSpecs[mtype]; ok {
+		return spec.Unpack(ctx, match)
 	}
 	return nil
 }
@@ -119,3 +113,21 @@ func UnpackMatchNot(ctx *errctx.Context, match map[string]interface{}) node.Matc
 
 	return node.Not{Child: m}
 }
+
+func UnpackMatchPassiveEffect(ctx *errctx.Context, match map[string]interface{}) node.Match {
+	errs := ctx.ErrorCount()
+	m := &node.PassiveEffectMatch{
+		Name:      unpack.OptionalString(ctx, match, key.Name, ""),
+		Operation: unpack.OptionalString(ctx, match, key.Operation, ""),
+		Tags:      unpack.OptionalStringArray(ctx, match, key.Tags),
+		Tier:      int(unpack.OptionalInteger(ctx, match, key.Tier, 0)),
+	}
+	if ctx.ErrorCount() != errs {
+		return nil
+	}
+	if m.Tier < 0 {
+		ctx.ErrorWithKey(fmt.Errorf("%q must not be negative", key.Tier), key.Tier)
+		return nil
+	}
+	return m
+}
@@ -40,7 +40,11 @@ func UnpackNode(ctx *errctx.Context, v map[string]interface{}) *node.Node {
 	rawActions := unpack.OptionalArray(ctx, v, key.Actions, nil)
 	rawChildren := unpack.OptionalArray(ctx, v, key.Children, nil)
 
-	n := &node.Node{}
+	n := &node.Node{
+		Name:   unpack.OptionalString(ctx, v, key.Name, ""),
+		Tags:   unpack.OptionalStringArray(ctx, v, key.Tags),
+		Source: CopyPath(ctx.Path),
+	}
 
 	if rawChildren != nil {
 		ctx.Path.Add(mpath.Key(key.Children))
@@ -0,0 +1,372 @@
+package impl
+
+import (
+	"fmt"
+
+	"github.com/tvarney/maputil/errctx"
+	"github.com/tvarney/sdtdmod/pkg/node"
+	"github.com/tvarney/sdtdmod/pkg/node/key"
+)
+
+// FieldKind is the kind of value a config key holds.
+type FieldKind int
+
+const (
+	KindString FieldKind = iota
+	KindNumber
+	KindInteger
+	KindBoolean
+	KindRegex
+	KindPath
+	KindStringList
+	KindIntegerList
+	KindMatch
+	KindMatchList
+	KindActionList
+	KindNodeList
+	KindAttrs
+	KindVars
+	KindProfiles
+	KindTestList
+	KindExpectList
+	KindStringMap
+)
+
+// Field describes a single key of a config object.
+type Field struct {
+	Name        string
+	Kind        FieldKind
+	Required    bool
+	Default     interface{}
+	Description string
+}
+
+// Spec describes the keys of a config object.
+//
+// Each entry of Alternatives is a set of keys of which at least one must be
+// present.
+type Spec struct {
+	Type         string
+	Description  string
+	Fields       []Field
+	Alternatives [][]string
+}
+
+// Field returns the field with the given name.
+func (s *Spec) Field(name string) (Field, bool) {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// MatchSpec describes a match type and how to unpack it.
+type MatchSpec struct {
+	Spec
+	Unpack func(*errctx.Context, map[string]interface{}) node.Match
+}
+
+// ActionSpec describes an action type and how to unpack it.
+type ActionSpec struct {
+	Spec
+	Unpack func(*errctx.Context, map[string]interface{}) node.Action
+}
+
+var (
+	// MatchSpecs holds the spec of every type in key.MatchTypes.
+	MatchSpecs = map[string]*MatchSpec{}
+	// ActionSpecs holds the spec of every type in key.ActionTypes.
+	ActionSpecs = map[string]*ActionSpec{}
+
+	// NodeSpec describes a configuration node.
+	NodeSpec = &Spec{
+		Description: "A node matches elements and applies actions to them and child nodes to their children.",
+		Fields: []Field{
+			{Name: key.Match, Kind: KindMatch, Description: "The match elements must satisfy; all elements match if omitted."},
+			{Name: key.Actions, Kind: KindActionList, Description: "The actions applied to matched elements."},
+			{Name: key.Children, Kind: KindNodeList, Description: "Nodes applied to the children of matched elements."},
+			{Name: key.Name, Kind: KindString, Description: "A name tests may use to run the node on its own."},
+			{Name: key.Tags, Kind: KindStringList, Description: "Tags used by profiles to enable or disable top-level nodes."},
+		},
+		Alternatives: [][]string{{key.Match, key.Actions, key.Children}},
+	}
+
+	// ConfigSpec describes the top level config object.
+	ConfigSpec = &Spec{
+		Description: "A configuration with variables, profiles, and included files.",
+		Fields: []Field{
+			{Name: key.Include, Kind: KindStringList, Description: "Files or directories to load, relative to this file."},
+			{Name: key.Nodes, Kind: KindNodeList, Description: "The nodes of the configuration."},
+			{Name: key.Profiles, Kind: KindProfiles, Description: "Named selections of tagged nodes and variable values."},
+			{Name: key.Tests, Kind: KindTestList, Description: "Test cases checking what the nodes do to sample XML."},
+			{Name: key.Vars, Kind: KindVars, Description: "Variables which may be referenced as ${name}."},
+		},
+	}
+
+	// TestSpec describes a test case.
+	TestSpec = &Spec{
+		Description: "A test case which applies nodes to sample XML and checks the result.",
+		Fields: []Field{
+			{Name: key.Name, Kind: KindString, Description: "The name of the test."},
+			{Name: key.Nodes, Kind: KindStringList, Description: "The names of the top-level nodes to apply; all nodes are applied if omitted."},
+			{Name: key.Input, Kind: KindString, Required: true, Description: "The XML the nodes are applied to."},
+			{Name: key.Output, Kind: KindString, Description: "The XML expected after applying the nodes, ignoring whitespace between elements and attribute order."},
+			{Name: key.Expect, Kind: KindExpectList, Description: "Attribute values expected after applying the nodes."},
+		},
+		Alternatives: [][]string{{key.Output, key.Expect}},
+	}
+
+	// ExpectSpec describes an expected attribute value of a test case.
+	ExpectSpec = &Spec{
+		Description: "An attribute value expected on the first element found by a path.",
+		Fields: []Field{
+			{Name: key.Path, Kind: KindPath, Required: true, Description: "The path of the element."},
+			{Name: key.Attr, Kind: KindString, Required: true, Description: "The name of the attribute."},
+			{Name: key.Value, Kind: KindString, Description: "The expected value; if omitted, the attribute must not exist."},
+		},
+	}
+
+	// ProfileSpec describes a profile.
+	ProfileSpec = &Spec{
+		Description: "A named selection of tagged top-level nodes and variable values.",
+		Fields: []Field{
+			{Name: key.Description, Kind: KindString, Description: "A description of the profile."},
+			{Name: key.Enable, Kind: KindStringList, Description: "If set, only tagged nodes with one of these tags are enabled."},
+			{Name: key.Disable, Kind: KindStringList, Description: "Tagged nodes with one of these tags are disabled."},
+			{Name: key.Vars, Kind: KindVars, Description: "Values of variables used with this profile."},
+		},
+	}
+
+	// AttrSelectorSpec describes the object form of an attribute selector.
+	AttrSelectorSpec = &Spec{
+		Description: "Selects attributes by name, prefix, suffix, or regex.",
+		Fields: []Field{
+			{Name: key.Names, Kind: KindStringList, Description: "Attribute names which are always selected."},
+			{Name: key.Prefix, Kind: KindString, Description: "Selects existing attributes starting with this prefix."},
+			{Name: key.Suffix, Kind: KindString, Description: "Selects existing attributes ending with this suffix."},
+			{Name: key.Regex, Kind: KindRegex, Description: "Selects existing attributes matching this regex."},
+		},
+		Alternatives: [][]string{{key.Names, key.Prefix, key.Suffix, key.Regex}},
+	}
+)
+
+// Fields shared by several specs.
+var (
+	condField    = Field{Name: key.Cond, Kind: KindMatch, Description: "The action is only applied to elements matching this."}
+	numberFields = []Field{
+		{Name: key.Mult, Kind: KindNumber, Default: 1.0, Description: "Multiplies the value."},
+		{Name: key.Add, Kind: KindNumber, Default: 0.0, Description: "Added to the value after multiplying."},
+		{Name: key.Min, Kind: KindNumber, Description: "The minimum result."},
+		{Name: key.Max, Kind: KindNumber, Description: "The maximum result."},
+		{Name: key.Prec, Kind: KindInteger, Default: -1, Description: "The number of decimal places to keep; -1 keeps all."},
+	}
+	matchListField = Field{Name: key.Matches, Kind: KindMatchList, Required: true, Description: "The sub-matches."}
+	attrsField     = Field{Name: key.Attrs, Kind: KindAttrs, Description: "Selects several attributes instead of one."}
+)
+
+// replaceField returns a copy of the fields with the one of the same name as
+// the given field replaced by it.
+func replaceField(fields []Field, field Field) []Field {
+	replaced := make([]Field, len(fields))
+	for idx, f := range fields {
+		if f.Name == field.Name {
+			f = field
+		}
+		replaced[idx] = f
+	}
+	return replaced
+}
+
+func init() {
+	registerMatch(&MatchSpec{Spec: Spec{
+		Type:        key.MatchTag,
+		Description: "Matches elements by tag name.",
+		Fields: []Field{
+			{Name: key.Value, Kind: KindString, Description: "The exact tag name."},
+			{Name: key.Regex, Kind: KindRegex, Description: "A regex the tag name must match."},
+			{Name: key.Prefix, Kind: KindString, Description: "A prefix the tag name must start with."},
+			{Name: key.Suffix, Kind: KindString, Description: "A suffix the tag name must end with."},
+		},
+	}, Unpack: UnpackMatchTag})
+	registerMatch(&MatchSpec{Spec: Spec{
+		Type:        key.MatchAttr,
+		Description: "Matches elements by the value of an attribute.",
+		Fields: []Field{
+			{Name: key.Name, Kind: KindString, Required: true, Description: "The name of the attribute, which must exist."},
+			{Name: key.Value, Kind: KindString, Description: "The exact attribute value."},
+			{Name: key.Regex, Kind: KindRegex, Description: "A regex the attribute value must match."},
+			{Name: key.Prefix, Kind: KindString, Description: "A prefix the attribute value must start with."},
+			{Name: key.Suffix, Kind: KindString, Description: "A suffix the attribute value must end with."},
+		},
+	}, Unpack: UnpackMatchAttr})
+	registerMatch(&MatchSpec{Spec: Spec{
+		Type:        key.MatchAllOf,
+		Description: "Matches elements which match all of the sub-matches.",
+		Fields:      []Field{matchListField},
+	}, Unpack: UnpackMatchAllOf})
+	registerMatch(&MatchSpec{Spec: Spec{
+		Type:        key.MatchAnyOf,
+		Description: "Matches elements which match at least one of the sub-matches.",
+		Fields:      []Field{matchListField},
+	}, Unpack: UnpackMatchAnyOf})
+	registerMatch(&MatchSpec{Spec: Spec{
+		Type:        key.MatchOneOf,
+		Description: "Matches elements which match exactly one of the sub-matches.",
+		Fields:      []Field{matchListField},
+	}, Unpack: UnpackMatchOneOf})
+	registerMatch(&MatchSpec{Spec: Spec{
+		Type:        key.MatchNot,
+		Description: "Matches elements which do not match the sub-match.",
+		Fields: []Field{
+			{Name: key.Match, Kind: KindMatch, Required: true, Description: "The sub-match."},
+		},
+	}, Unpack: UnpackMatchNot})
+	registerMatch(&MatchSpec{Spec: Spec{
+		Type:        key.MatchPassiveEffect,
+		Description: "Matches passive_effect elements by name, operation, tags, and tier.",
+		Fields: []Field{
+			{Name: key.Name, Kind: KindString, Description: "The name of the effect."},
+			{Name: key.Operation, Kind: KindString, Description: "The operation of the effect, such as base_add or perc_add."},
+			{Name: key.Tags, Kind: KindStringList, Description: "Tags the effect must all have."},
+			{Name: key.Tier, Kind: KindInteger, Description: "A tier the effect must apply to."},
+		},
+	}, Unpack: UnpackMatchPassiveEffect})
+
+	registerAction(&ActionSpec{Spec: Spec{
+		Type:        key.ActionNumber,
+		Description: "Multiplies, offsets, and clamps numeric attributes, including comma separated lists.",
+		Fields: append(append([]Field{
+			{Name: key.Attr, Kind: KindString, Description: "The attribute to update."},
+			attrsField,
+		}, numberFields...), condField),
+		Alternatives: [][]string{{key.Attr, key.Attrs}},
+	}, Unpack: UnpackActionNumber})
+	registerAction(&ActionSpec{Spec: Spec{
+		Type:        key.ActionAppendText,
+		Description: "Appends text to attributes, creating them if needed.",
+		Fields: []Field{
+			{Name: key.Name, Kind: KindString, Description: "The attribute to append to."},
+			attrsField,
+			{Name: key.Value, Kind: KindString, Required: true, Description: "The text to append."},
+			condField,
+		},
+		Alternatives: [][]string{{key.Name, key.Attrs}},
+	}, Unpack: UnpackActionAppendText})
+	registerAction(&ActionSpec{Spec: Spec{
+		Type:        key.ActionCloneElement,
+		Description: "Inserts a copy of the element after it, unless a sibling already has the attributes the copy sets.",
+		Fields: []Field{
+			{Name: key.Set, Kind: KindStringMap, Required: true, Description: "Attributes to set on the copy; {@attr} is replaced by attributes of the element."},
+			condField,
+		},
+	}, Unpack: UnpackActionCloneElement})
+	registerAction(&ActionSpec{Spec: Spec{
+		Type:        key.ActionCopyFrom,
+		Description: "Copies an attribute of another element into an attribute, optionally transforming it as a number.",
+		Fields: append(append([]Field{
+			{Name: key.Attr, Kind: KindString, Required: true, Description: "The attribute to set."},
+			{Name: key.Path, Kind: KindPath, Description: "An etree path to the source element; {@attr} is replaced by attributes of the element."},
+			{Name: key.Document, Kind: KindString, Description: "The data file to search instead of the element's own."},
+			{Name: key.Match, Kind: KindMatch, Description: "The match the source element must satisfy."},
+			{Name: key.From, Kind: KindString, Default: key.Value, Description: "The attribute of the source element to copy."},
+		}, numberFields...), condField),
+		Alternatives: [][]string{{key.Path, key.Match}},
+	}, Unpack: UnpackActionCopyFrom})
+	registerAction(&ActionSpec{Spec: Spec{
+		Type:        key.ActionInsertAttr,
+		Description: "Sets attributes to a value, creating them if needed.",
+		Fields: []Field{
+			{Name: key.Name, Kind: KindString, Description: "The attribute to set."},
+			attrsField,
+			{Name: key.Value, Kind: KindString, Required: true, Description: "The value to set."},
+			condField,
+		},
+		Alternatives: [][]string{{key.Name, key.Attrs}},
+	}, Unpack: UnpackActionInsertAttr})
+	registerAction(&ActionSpec{Spec: Spec{
+		Type:        key.ActionInsertElement,
+		Description: "Reserved; not implemented yet.",
+	}, Unpack: UnpackActionInsertElement})
+	registerAction(&ActionSpec{Spec: Spec{
+		Type:        key.ActionRemoveAttr,
+		Description: "Removes attributes.",
+		Fields: []Field{
+			{Name: key.Name, Kind: KindString, Description: "The attribute to remove."},
+			attrsField,
+			condField,
+		},
+		Alternatives: [][]string{{key.Name, key.Attrs}},
+	}, Unpack: UnpackActionRemoveAttr})
+	registerAction(&ActionSpec{Spec: Spec{
+		Type:        key.ActionRemoveElement,
+		Description: "Reserved; not implemented yet.",
+	}, Unpack: UnpackActionRemoveElement})
+	registerAction(&ActionSpec{Spec: Spec{
+		Type:        key.ActionScaleLoot,
+		Description: "Scales the chance of loot entries being picked from loot group and container elements.",
+		Fields: []Field{
+			{Name: key.Item, Kind: KindString, Description: "The item whose entries to update."},
+			{Name: key.Group, Kind: KindString, Description: "The group whose entries to update."},
+			{Name: key.Mult, Kind: KindNumber, Required: true, Description: "The factor to scale the chance of each entry by."},
+			{Name: key.Level, Kind: KindNumber, Default: 1, Description: "The loot level used for loot prob templates."},
+			condField,
+		},
+		Alternatives: [][]string{{key.Item, key.Group}},
+	}, Unpack: UnpackActionScaleLoot})
+	registerAction(&ActionSpec{Spec: Spec{
+		Type:        key.ActionScaleRecipe,
+		Description: "Scales the ingredient counts of recipe elements, keeping them whole numbers.",
+		Fields: []Field{
+			{Name: key.Names, Kind: KindStringList, Description: "The ingredients to scale."},
+			{Name: key.Tags, Kind: KindStringList, Description: "Scale ingredients whose item has one of these tags in items.xml."},
+			{Name: key.Mult, Kind: KindNumber, Default: 1, Description: "The factor to scale ingredient counts by."},
+			{Name: key.Round, Kind: KindString, Default: node.RoundNearest, Description: "How to round scaled counts: nearest, up, or down."},
+			{Name: key.Min, Kind: KindInteger, Default: 1, Description: "The smallest count an ingredient may have."},
+			{Name: key.CraftTime, Kind: KindNumber, Description: "The factor to scale the craft time of updated recipes by."},
+			{Name: key.OutputCount, Kind: KindNumber, Default: 1, Description: "The factor to scale the number of items updated recipes make by."},
+			condField,
+		},
+	}, Unpack: UnpackActionScaleRecipe})
+	registerAction(&ActionSpec{Spec: Spec{
+		Type:        key.ActionScalePassiveEffect,
+		Description: "Updates the values of a passive_effect, only for the chosen tiers if any.",
+		Fields: append(append([]Field{
+			{Name: key.Tiers, Kind: KindIntegerList, Description: "The tiers whose values to update; every tier if not set."},
+		}, replaceField(numberFields,
+			Field{Name: key.Prec, Kind: KindInteger, Default: 6, Description: "The number of decimal places to keep."},
+		)...), condField),
+	}, Unpack: UnpackActionScalePassiveEffect})
+	registerAction(&ActionSpec{Spec: Spec{
+		Type:        key.ActionAddPassiveEffect,
+		Description: "Adds a passive_effect to an effect_group which has none with the same name and operation.",
+		Fields: []Field{
+			{Name: key.Name, Kind: KindString, Required: true, Description: "The name of the effect."},
+			{Name: key.Operation, Kind: KindString, Required: true, Description: "The operation of the effect."},
+			{Name: key.Value, Kind: KindString, Required: true, Description: "The value, or comma separated values, of the effect."},
+			{Name: key.Tier, Kind: KindString, Description: "The comma separated tiers the values are for."},
+			{Name: key.Tags, Kind: KindStringList, Description: "The tags of the effect."},
+			condField,
+		},
+	}, Unpack: UnpackActionAddPassiveEffect})
+
+	for _, t := range key.MatchTypes {
+		if _, ok := MatchSpecs[t]; !ok {
+			panic(fmt.Sprintf("match type %q is not registered", t))
+		}
+	}
+	for _, t := range key.ActionTypes {
+		if _, ok := ActionSpecs[t]; !ok {
+			panic(fmt.Sprintf("action type %q is not registered", t))
+		}
+	}
+}
+
+func registerMatch(spec *MatchSpec) {
+	MatchSpecs[spec.Type] = spec
+}
+
+func registerAction(spec *ActionSpec) {
+	ActionSpecs[spec.Type] = spec
+}
@@ -0,0 +1,131 @@
+package impl
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/tvarney/sdtdmod/pkg/errors"
+	"github.com/tvarney/sdtdmod/pkg/node/key"
+)
+
+// sampleValues are values of each kind of field which differ from the
+// defaults, so that an unpacked field shows up when serialized.
+var sampleValues = map[FieldKind]interface{}{
+	KindString:      "a",
+	KindNumber:      2.0,
+	KindInteger:     2.0,
+	KindBoolean:     true,
+	KindRegex:       "^a$",
+	KindPath:        "/items/item",
+	KindStringList:  []interface{}{"a"},
+	KindIntegerList: []interface{}{1.0, 2.0},
+	KindMatch:       map[string]interface{}{key.Type: key.MatchTag, key.Value: "item"},
+	KindMatchList:   []interface{}{map[string]interface{}{key.Type: key.MatchTag, key.Value: "item"}},
+	KindAttrs:       map[string]interface{}{key.Names: []interface{}{"a"}},
+	KindStringMap:   map[string]interface{}{"name": "a"},
+}
+
+// sampleKeys are values for fields which only accept some strings.
+var sampleKeys = map[string]interface{}{
+	key.Round:    "up",
+	key.Tier:     "1,2",
+	key.Document: "items.xml",
+}
+
+func sample(f Field) interface{} {
+	if v, ok := sampleKeys[f.Name]; ok && f.Kind == KindString {
+		return v
+	}
+	return sampleValues[f.Kind]
+}
+
+// sampleObject returns an object of the spec with every required field, one
+// field of each set of alternatives, and the given field.
+func sampleObject(spec *Spec, field Field) map[string]interface{} {
+	obj := map[string]interface{}{key.Type: spec.Type, field.Name: sample(field)}
+	for _, f := range spec.Fields {
+		if f.Required {
+			obj[f.Name] = sample(f)
+		}
+	}
+	for _, alts := range spec.Alternatives {
+		found := false
+		for _, name := range alts {
+			_, ok := obj[name]
+			found = found || ok
+		}
+		if !found {
+			f, _ := spec.Field(alts[0])
+			obj[f.Name] = sample(f)
+		}
+	}
+	return obj
+}
+
+// TestSpecFields checks that the fields of each registered match and action
+// are those its unpack function reads: each field given on its own is
+// unpacked without error and serialized again, and nothing is serialized
+// which is not a field.
+func TestSpecFields(t *testing.T) {
+	type unpacked interface {
+		Serialize() map[string]interface{}
+	}
+	specs := map[string]*Spec{}
+	unpackers := map[string]func(obj map[string]interface{}) (unpacked, *errors.ErrorCollector){}
+	for name, spec := range MatchSpecs {
+		spec := spec
+		specs["match "+name] = &spec.Spec
+		unpackers["match "+name] = func(obj map[string]interface{}) (unpacked, *errors.ErrorCollector) {
+			collector := &errors.ErrorCollector{}
+			m := spec.Unpack(CreateErrCtx("test", collector), obj)
+			if m == nil {
+				return nil, collector
+			}
+			return m, collector
+		}
+	}
+	for name, spec := range ActionSpecs {
+		spec := spec
+		specs["action "+name] = &spec.Spec
+		unpackers["action "+name] = func(obj map[string]interface{}) (unpacked, *errors.ErrorCollector) {
+			collector := &errors.ErrorCollector{}
+			a := spec.Unpack(CreateErrCtx("test", collector), obj)
+			if a == nil {
+				return nil, collector
+			}
+			return a, collector
+		}
+	}
+
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		spec := specs[name]
+		if len(spec.Fields) == 0 {
+			// Reserved types which are not implemented yet.
+			continue
+		}
+		for _, field := range spec.Fields {
+			t.Run(fmt.Sprintf("%s/%s", name, field.Name), func(t *testing.T) {
+				obj := sampleObject(spec, field)
+				value, collector := unpackers[name](obj)
+				if len(collector.Errors) > 0 || value == nil {
+					t.Fatalf("unpacking %v failed: %v", obj, collector.Errors)
+				}
+				serialized := value.Serialize()
+				if _, ok := serialized[field.Name]; !ok {
+					t.Errorf("%q is not read: %v was serialized as %v", field.Name, obj, serialized)
+				}
+				for k := range serialized {
+					if _, ok := spec.Field(k); !ok && k != key.Type {
+						t.Errorf("%q is serialized but is not a field", k)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package impl
+
+import (
+	"fmt"
+
+	"github.com/beevik/etree"
+	"github.com/tvarney/maputil"
+	"github.com/tvarney/maputil/errctx"
+	"github.com/tvarney/maputil/mpath"
+	"github.com/tvarney/maputil/unpack"
+	"github.com/tvarney/sdtdmod/pkg/node"
+	"github.com/tvarney/sdtdmod/pkg/node/key"
+)
+
+// UnpackTestList takes the JSON list of a 'tests' block and unpacks each test.
+func UnpackTestList(ctx *errctx.Context, v []interface{}) []*node.Test {
+	tests := make([]*node.Test, 0, len(v))
+	for idx, obj := range v {
+		ctx.Path.Add(mpath.Index(idx))
+		m, ok := obj.(map[string]interface{})
+		if !ok {
+			ctx.Error(maputil.InvalidTypeError{Expected: []string{maputil.TypeObject}, Actual: maputil.TypeName(obj)})
+			ctx.Path.Pop()
+			continue
+		}
+		if t := UnpackTest(ctx, m); t != nil {
+			tests = append(tests, t)
+		}
+		ctx.Path.Pop()
+	}
+	return tests
+}
+
+// UnpackTest takes a JSON object and unpacks it to a Test.
+//
+// The input and expected output are checked to be well formed XML.
+func UnpackTest(ctx *errctx.Context, v map[string]interface{}) *node.Test {
+	t := &node.Test{
+		Name:   unpack.OptionalString(ctx, v, key.Name, ""),
+		Nodes:  unpack.OptionalStringArray(ctx, v, key.Nodes),
+		Input:  unpack.RequireString(ctx, v, key.Input),
+		Output: unpack.OptionalString(ctx, v, key.Output, ""),
+		Source: CopyPath(ctx.Path),
+	}
+	for _, k := range []string{key.Input, key.Output} {
+		if raw, ok := v[k].(string); ok {
+			if err := etree.NewDocument().ReadFromString(raw); err != nil {
+				ctx.ErrorWithKey(fmt.Errorf("invalid XML: %v", err), k)
+			}
+		}
+	}
+
+	rawExpect := unpack.OptionalArray(ctx, v, key.Expect, nil)
+	if rawExpect != nil {
+		ctx.Path.Add(mpath.Key(key.Expect))
+		for idx, obj := range rawExpect {
+			ctx.Path.Add(mpath.Index(idx))
+			if m, err := maputil.AsObject(obj); err != nil {
+				ctx.Error(err)
+			} else {
+				t.Expect = append(t.Expect, unpackExpectation(ctx, m))
+			}
+			ctx.Path.Pop()
+		}
+		ctx.Path.Pop()
+	}
+
+	if t.Output == "" && len(t.Expect) == 0 {
+		ctx.Error(fmt.Errorf("test requires at least one of %q or %q", key.Output, key.Expect))
+		return nil
+	}
+	return t
+}
+
+func unpackExpectation(ctx *errctx.Context, v map[string]interface{}) node.Expectation {
+	e := node.Expectation{
+		Path: unpack.RequireString(ctx, v, key.Path),
+		Attr: unpack.RequireString(ctx, v, key.Attr),
+	}
+	if _, ok := v[key.Value]; ok {
+		e.Value = unpack.OptionalString(ctx, v, key.Value, "")
+	} else {
+		e.Absent = true
+	}
+	if e.Path != "" {
+		if _, err := etree.CompilePath(e.Path); err != nil {
+			ctx.ErrorWithKey(err, key.Path)
+		}
+	}
+	return e
+}
@@ -1,9 +1,12 @@
 package impl
 
 import (
+	"fmt"
 	"log"
 	"regexp"
 
+	"github.com/beevik/etree"
+	"github.com/tvarney/maputil"
 	"github.com/tvarney/maputil/errctx"
 	"github.com/tvarney/maputil/mpath"
 	"github.com/tvarney/maputil/unpack"
@@ -33,12 +36,25 @@ func GetError(ctx *errctx.Context) error {
 		Count: count,
 		Name:  ctx.Path.Filename,
 	}
-	if h, ok := ctx.Handler.(*errors.ErrorCollector); ok {
+	handler := ctx.Handler
+	if h, ok := handler.(*errors.PositionHandler); ok {
+		handler = h.Handler
+	}
+	if h, ok := handler.(*errors.ErrorCollector); ok {
 		e.Errors = h.Errors
 	}
 	return e
 }
 
+// CopyPath returns a copy of the path.
+//
+// Unlike mpath.Path.Copy, this keeps the filename of an empty path.
+func CopyPath(p *mpath.Path) *mpath.Path {
+	c := p.Copy()
+	c.Filename = p.Filename
+	return c
+}
+
 // UnpackRegex unpacks a regex
 func UnpackRegex(ctx *errctx.Context, obj map[string]interface{}) *regexp.Regexp {
 	raw := unpack.OptionalString(ctx, obj, key.Regex, "")
@@ -65,3 +81,96 @@ func UnpackCondition(ctx *errctx.Context, action map[string]interface{}) node.Ma
 	ctx.Path.Pop()
 	return cond
 }
+
+// UnpackPath fetches the 'path' key and checks that it is a valid etree path.
+//
+// Placeholders in the path are substituted with a dummy value before checking.
+func UnpackPath(ctx *errctx.Context, obj map[string]interface{}) string {
+	raw := unpack.OptionalString(ctx, obj, key.Path, "")
+	if raw == "" {
+		return ""
+	}
+	expanded, err := node.ExpandPlaceholders(raw, func(string) (string, bool) {
+		return "placeholder", true
+	})
+	if err == nil {
+		_, err = etree.CompilePath(expanded)
+	}
+	if err != nil {
+		ctx.ErrorWithKey(err, key.Path)
+		return ""
+	}
+	return raw
+}
+
+// UnpackAttrTarget fetches the attributes an action operates on.
+//
+// An action names either a single attribute using the given key, or a set of
+// attributes using the 'attrs' key. The final return value is false if
+// neither or both were given, or if either was invalid.
+func UnpackAttrTarget(ctx *errctx.Context, obj map[string]interface{}, nameKey string) (string, *node.AttrSelector, bool) {
+	_, hasName := obj[nameKey]
+	_, hasAttrs := obj[key.Attrs]
+	switch {
+	case hasName && hasAttrs:
+		ctx.Error(fmt.Errorf("only one of %q or %q may be given", nameKey, key.Attrs))
+		return "", nil, false
+	case hasAttrs:
+		ctx.Path.Add(mpath.Key(key.Attrs))
+		sel := UnpackAttrSelector(ctx, obj[key.Attrs])
+		ctx.Path.Pop()
+		return "", sel, sel != nil
+	}
+
+	name := unpack.RequireString(ctx, obj, nameKey)
+	return name, nil, name != ""
+}
+
+// UnpackAttrSelector unpacks an attribute selector.
+//
+// The selector may be a list of attribute names, or an object with any of the
+// 'names', 'prefix', 'suffix', and 'regex' keys.
+func UnpackAttrSelector(ctx *errctx.Context, raw interface{}) *node.AttrSelector {
+	switch v := raw.(type) {
+	case []interface{}:
+		names := make([]string, 0, len(v))
+		for idx, item := range v {
+			name, err := maputil.AsString(item)
+			if err != nil {
+				ctx.ErrorWithIndex(err, idx)
+				continue
+			}
+			names = append(names, name)
+		}
+		if len(names) != len(v) {
+			return nil
+		}
+		if len(names) == 0 {
+			ctx.Error(fmt.Errorf("attribute list may not be empty"))
+			return nil
+		}
+		return &node.AttrSelector{Names: names}
+	case map[string]interface{}:
+		errs := ctx.ErrorCount()
+		sel := &node.AttrSelector{
+			Names:  unpack.OptionalStringArray(ctx, v, key.Names),
+			Prefix: unpack.OptionalString(ctx, v, key.Prefix, ""),
+			Suffix: unpack.OptionalString(ctx, v, key.Suffix, ""),
+			Regex:  UnpackRegex(ctx, v),
+		}
+		if ctx.ErrorCount() != errs {
+			return nil
+		}
+		if len(sel.Names) == 0 && sel.Prefix == "" && sel.Suffix == "" && sel.Regex == nil {
+			ctx.Error(fmt.Errorf("attribute selector requires at least one of %q, %q, %q, or %q",
+				key.Names, key.Prefix, key.Suffix, key.Regex))
+			return nil
+		}
+		return sel
+	}
+	ctx.Error(maputil.InvalidTypeError{
+		Expected: []string{maputil.TypeArray, maputil.TypeObject},
+		Actual:   maputil.TypeName(raw),
+	})
+	return nil
+}
@@ -0,0 +1,195 @@
+package impl
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tvarney/maputil"
+	"github.com/tvarney/maputil/errctx"
+	"github.com/tvarney/maputil/mpath"
+	"github.com/tvarney/sdtdmod/pkg/errors"
+)
+
+// UnpackVars takes the JSON object of a 'vars' block and adds each variable to
+// the state.
+//
+// Variables must be numbers, strings, or booleans. If the selected profile
+// sets a variable, its value replaces the declared one and must have the same
+// type. If an override is given for a variable, it is converted to the type of
+// the declared value and replaces both.
+func UnpackVars(ctx *errctx.Context, raw map[string]interface{}, state *ConfigState) {
+	names := maputil.Keys(raw)
+	sort.Strings(names)
+	for _, name := range names {
+		value := raw[name]
+		switch value.(type) {
+		case float64, string, bool:
+		default:
+			ctx.ErrorWithKey(maputil.InvalidTypeError{
+				Expected: []string{maputil.TypeNumber, maputil.TypeString, maputil.TypeBoolean},
+				Actual:   maputil.TypeName(value),
+			}, name)
+			continue
+		}
+
+		profile := state.Selected
+		if profile == nil {
+			profile = state.Profiles[state.Profile]
+		}
+		if profile != nil {
+			if pv, ok := profile.Vars[name]; ok {
+				if varType(pv) != varType(value) {
+					ctx.ErrorWithKey(fmt.Errorf("profile %q sets %s; expected %s",
+						profile.Name, varType(pv), varType(value)), name)
+				} else {
+					value = pv
+				}
+			}
+		}
+		if override, ok := state.Overrides[name]; ok {
+			v, err := convertOverride(override, value)
+			if err != nil {
+				ctx.ErrorWithKey(err, name)
+			} else {
+				value = v
+			}
+		}
+		state.Vars[name] = value
+	}
+}
+
+// varType returns the name of the type of a variable value.
+func varType(value interface{}) string {
+	switch value.(type) {
+	case float64:
+		return maputil.TypeNumber
+	case string:
+		return maputil.TypeString
+	case bool:
+		return maputil.TypeBoolean
+	}
+	return maputil.TypeName(value)
+}
+
+// convertOverride converts the override to the same type as the declared
+// value of the variable.
+func convertOverride(override string, declared interface{}) (interface{}, error) {
+	switch declared.(type) {
+	case float64:
+		v, err := strconv.ParseFloat(override, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid override %q; expected %s", override, maputil.TypeNumber)
+		}
+		return v, nil
+	case bool:
+		v, err := strconv.ParseBool(override)
+		if err != nil {
+			return nil, fmt.Errorf("invalid override %q; expected %s", override, maputil.TypeBoolean)
+		}
+		return v, nil
+	}
+	return override, nil
+}
+
+// ResolveVars replaces every `${name}` reference in the strings of value with
+// the value of the named variable.
+//
+// A string which consists of a single reference is replaced by the variable
+// itself, so numeric and boolean variables keep their type; references inside
+// a longer string are formatted and substituted. `$${` may be used to write a
+// literal `${`. The type of the result is checked by the unpack functions as
+// usual, so type errors are reported at the location of the reference.
+//
+// Object keys whose value could not be resolved are dropped, so the error is
+// not reported a second time as a type error.
+func ResolveVars(ctx *errctx.Context, value interface{}, vars map[string]interface{}) interface{} {
+	resolved, _ := resolve(ctx, value, vars)
+	return resolved
+}
+
+func resolve(ctx *errctx.Context, value interface{}, vars map[string]interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		return resolveString(ctx, v, vars)
+	case []interface{}:
+		resolved := make([]interface{}, 0, len(v))
+		for idx, item := range v {
+			ctx.Path.Add(mpath.Index(idx))
+			r, _ := resolve(ctx, item, vars)
+			resolved = append(resolved, r)
+			ctx.Path.Pop()
+		}
+		return resolved, true
+	case map[string]interface{}:
+		keys := maputil.Keys(v)
+		sort.Strings(keys)
+		resolved := make(map[string]interface{}, len(v))
+		for _, k := range keys {
+			ctx.Path.Add(mpath.Key(k))
+			if r, ok := resolve(ctx, v[k], vars); ok {
+				resolved[k] = r
+			}
+			ctx.Path.Pop()
+		}
+		return resolved, true
+	}
+	return value, true
+}
+
+func resolveString(ctx *errctx.Context, s string, vars map[string]interface{}) (interface{}, bool) {
+	if !strings.Contains(s, "${") {
+		return s, true
+	}
+	if strings.HasPrefix(s, "${") && strings.Index(s, "}") == len(s)-1 {
+		name := s[2 : len(s)-1]
+		value, ok := vars[name]
+		if !ok {
+			ctx.Error(errors.UndefinedVariableError(name))
+			return s, false
+		}
+		return value, true
+	}
+
+	builder := strings.Builder{}
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			builder.WriteString(s)
+			return builder.String(), true
+		}
+		if start > 0 && s[start-1] == '$' {
+			builder.WriteString(s[:start-1])
+			builder.WriteString("${")
+			s = s[start+2:]
+			continue
+		}
+		end := strings.IndexRune(s[start:], '}')
+		if end < 0 {
+			ctx.Error(fmt.Errorf("unterminated variable reference in %q", s))
+			return s, false
+		}
+		name := s[start+2 : start+end]
+		value, ok := vars[name]
+		if !ok {
+			ctx.Error(errors.UndefinedVariableError(name))
+			return s, false
+		}
+		builder.WriteString(s[:start])
+		builder.WriteString(formatVar(value))
+		s = s[start+end+1:]
+	}
+}
+
+func formatVar(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	}
+	return fmt.Sprint(value)
+}
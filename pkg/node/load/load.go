@@ -1,63 +1,434 @@
 package load
 
 import (
-	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
-	"github.com/tvarney/maputil/consterr"
 	"github.com/tvarney/maputil/errctx"
+	"github.com/tvarney/maputil/mpath"
+	"github.com/tvarney/sdtdmod/pkg/errors"
 	"github.com/tvarney/sdtdmod/pkg/node"
+	"github.com/tvarney/sdtdmod/pkg/node/key"
 	"github.com/tvarney/sdtdmod/pkg/node/load/impl"
 )
 
-func LoadFile(filename string, handlers ...errctx.ErrorHandler) ([]*node.Node, error) {
-	data, err := ioutil.ReadFile(filename)
+// EnvPrefix is the prefix of environment variables which override config
+// variables.
+const EnvPrefix = "SDTDMOD_VAR_"
+
+// Options controls how a configuration is loaded.
+type Options struct {
+	// Vars overrides the values of variables declared by the configuration.
+	Vars map[string]string
+	// EnvVars overrides the values of variables like Vars, but with less
+	// priority. Overrides of undeclared variables are only warned about, as
+	// the environment may be shared by several configurations.
+	EnvVars map[string]string
+	// Profile is the name of the profile to select.
+	Profile string
+	// Lenient reports unexpected keys as warnings instead of errors.
+	Lenient bool
+	// Lint reports likely mistakes in nodes, such as actions with no effect.
+	Lint bool
+}
+
+// Config is a loaded configuration.
+//
+// Files lists the name of every file which was read, starting with the root
+// of the configuration followed by each include in the order loaded.
+//
+// If a profile was selected, Nodes only holds the top-level nodes it enables
+// while AllNodes holds every top-level node.
+//
+// Positions holds the source position of the values of every file, which may
+// be used with the Source of each node and test.
+//
+// Tests holds the test cases of every file, whichever profile is selected.
+type Config struct {
+	Nodes     []*node.Node
+	Tests     []*node.Test
+	AllNodes  []*node.Node
+	Vars      map[string]interface{}
+	Files     []string
+	Profiles  []*node.Profile
+	Profile   *node.Profile
+	Positions *errors.Positions
+}
+
+// EnvVars returns the variable overrides given in the environment.
+//
+// Each entry of environ which starts with EnvPrefix is returned with the
+// prefix removed.
+func EnvVars(environ []string) map[string]string {
+	vars := map[string]string{}
+	for _, env := range environ {
+		if !strings.HasPrefix(env, EnvPrefix) {
+			continue
+		}
+		if idx := strings.IndexRune(env, '='); idx > len(EnvPrefix) {
+			vars[env[len(EnvPrefix):idx]] = env[idx+1:]
+		}
+	}
+	return vars
+}
+
+// LoadFile loads a configuration from the given path.
+//
+// If the path is a directory, every configuration file directly inside it is
+// loaded in order of filename, as if they were included by a single file.
+func LoadFile(filename string, opts *Options, handlers ...errctx.ErrorHandler) (*Config, error) {
+	info, err := os.Stat(filename)
 	if err != nil {
 		return nil, err
 	}
-	return LoadBytes(filename, data, handlers...)
+
+	l := newLoader(filename, opts, handlers...)
+	if !info.IsDir() {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		value, err := decode(filename, data, l.positions)
+		if err != nil {
+			return nil, err
+		}
+		l.selectProfile(filename, value)
+		l.cfg.Nodes = l.loadValue(filename, value)
+		return l.finish()
+	}
+
+	files, err := l.listDir(filename)
+	if err != nil {
+		return nil, err
+	}
+	l.selectProfile(filename, nil, files...)
+	l.cfg.Files = append(l.cfg.Files, filename)
+	for _, file := range files {
+		l.cfg.Nodes = append(l.cfg.Nodes, l.include(file)...)
+	}
+	return l.finish()
 }
 
-func LoadReader(name string, r io.Reader, handlers ...errctx.ErrorHandler) ([]*node.Node, error) {
+func LoadReader(name string, r io.Reader, opts *Options, handlers ...errctx.ErrorHandler) (*Config, error) {
 	data, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
-	return LoadBytes(name, data, handlers...)
+	return LoadBytes(name, data, opts, handlers...)
+}
+
+func LoadValue(name string, value interface{}, opts *Options, handlers ...errctx.ErrorHandler) (*Config, error) {
+	l := newLoader(name, opts, handlers...)
+	l.selectProfile(name, value)
+	l.cfg.Nodes = l.loadValue(name, value)
+	return l.finish()
+}
+
+// LoadBytes loads a configuration from the data of a file.
+//
+// The format of the data is chosen based on the extension of the name.
+func LoadBytes(name string, data []byte, opts *Options, handlers ...errctx.ErrorHandler) (*Config, error) {
+	l := newLoader(name, opts, handlers...)
+	value, err := decode(name, data, l.positions)
+	if err != nil {
+		return nil, err
+	}
+	l.selectProfile(name, value)
+	l.cfg.Nodes = l.loadValue(name, value)
+	return l.finish()
 }
 
-func LoadValue(name string, value interface{}, handlers ...errctx.ErrorHandler) ([]*node.Node, error) {
-	ctx := impl.CreateErrCtx(name, handlers...)
-	switch v := value.(type) {
-	case []interface{}:
-		nl := impl.UnpackNodeList(ctx, v)
-		return nl, impl.GetError(ctx)
-	case map[string]interface{}:
-		n := impl.UnpackNode(ctx, v)
-		if n == nil {
-			return nil, impl.GetError(ctx)
+// loader holds the state shared by a configuration and the files it
+// includes.
+type loader struct {
+	ctx       *errctx.Context
+	opts      *Options
+	cfg       *Config
+	state     *impl.ConfigState
+	positions *errors.Positions
+	stack     []string
+}
+
+func newLoader(name string, opts *Options, handlers ...errctx.ErrorHandler) *loader {
+	if opts == nil {
+		opts = &Options{}
+	}
+	l := &loader{
+		ctx:       impl.CreateErrCtx(name, handlers...),
+		opts:      opts,
+		cfg:       &Config{},
+		positions: errors.NewPositions(),
+	}
+	overrides := make(map[string]string, len(opts.EnvVars)+len(opts.Vars))
+	for name, value := range opts.EnvVars {
+		overrides[name] = value
+	}
+	for name, value := range opts.Vars {
+		overrides[name] = value
+	}
+	l.state = impl.NewConfigState(overrides, opts.Profile, l.includePath)
+	l.state.Lenient = opts.Lenient
+	l.state.Lint = opts.Lint
+	l.cfg.Vars = l.state.Vars
+	l.cfg.Positions = l.positions
+	l.ctx.Handler = &errors.PositionHandler{Positions: l.positions, Handler: l.ctx.Handler}
+	return l
+}
+
+func (l *loader) finish() (*Config, error) {
+	l.cfg.AllNodes = l.cfg.Nodes
+	l.cfg.Tests = l.state.Tests
+	names := make([]string, 0, len(l.state.Profiles))
+	for name := range l.state.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		l.cfg.Profiles = append(l.cfg.Profiles, l.state.Profiles[name])
+	}
+
+	if l.opts.Profile != "" {
+		profile, ok := l.state.Profiles[l.opts.Profile]
+		if ok {
+			l.cfg.Profile = profile
+			l.cfg.Nodes = profile.Filter(l.cfg.Nodes)
+			checkProfileVars(l.ctx, profile, l.cfg)
+		} else {
+			l.ctx.ErrorWithKey(fmt.Errorf("unknown profile %q", l.opts.Profile), key.Profiles)
 		}
-		return []*node.Node{n}, impl.GetError(ctx)
 	}
-	return nil, consterr.Error("")
+	checkOverrides(l.ctx, l.opts, l.cfg)
+	return l.cfg, impl.GetError(l.ctx)
 }
 
-func LoadBytes(name string, data []byte, handlers ...errctx.ErrorHandler) ([]*node.Node, error) {
-	ctx := impl.CreateErrCtx(name, handlers...)
-	var arr []interface{}
-	if err := json.Unmarshal(data, &arr); err == nil {
-		nl := impl.UnpackNodeList(ctx, arr)
-		return nl, impl.GetError(ctx)
+func (l *loader) loadBytes(name string, data []byte) []*node.Node {
+	value, err := decode(name, data, l.positions)
+	if err != nil {
+		l.ctx.Error(err)
+		return nil
 	}
+	return l.loadValue(name, value)
+}
+
+func (l *loader) loadValue(name string, value interface{}) []*node.Node {
+	l.cfg.Files = append(l.cfg.Files, name)
+	if abs, err := filepath.Abs(name); err == nil {
+		l.stack = append(l.stack, abs)
+		defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+	}
+
+	return impl.UnpackConfig(l.ctx, value, l.state)
+}
+
+// includePath loads the file or directory included by the file currently
+// being loaded.
+func (l *loader) includePath(ctx *errctx.Context, path string) []*node.Node {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(ctx.Path.Filename), path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		ctx.Error(err)
+		return nil
+	}
+	if !info.IsDir() {
+		return l.include(path)
+	}
+
+	files, err := l.listDir(path)
+	if err != nil {
+		ctx.Error(err)
+		return nil
+	}
+	var nodes []*node.Node
+	for _, file := range files {
+		nodes = append(nodes, l.include(file)...)
+	}
+	return nodes
+}
 
-	var m map[string]interface{}
-	if err := json.Unmarshal(data, &m); err != nil {
+// include loads the nodes of another file.
+//
+// Errors in the file are reported with paths relative to that file, and the
+// error path of the including file is restored afterwards.
+func (l *loader) include(filename string) []*node.Node {
+	if abs, err := filepath.Abs(filename); err == nil {
+		for idx, f := range l.stack {
+			if f == abs {
+				cycle := append(append([]string{}, l.stack[idx:]...), abs)
+				l.ctx.Error(fmt.Errorf("include cycle: %s", strings.Join(cycle, " -> ")))
+				return nil
+			}
+		}
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		l.ctx.Error(err)
+		return nil
+	}
+
+	parent := l.ctx.Path
+	l.ctx.Path = mpath.New(parent.Style)
+	l.ctx.Path.Filename = filename
+	defer func() { l.ctx.Path = parent }()
+	return l.loadBytes(filename, data)
+}
+
+// selectProfile finds the selected profile in the configuration, or the
+// given files if the configuration is a directory, and the files they include
+// before anything is unpacked.
+//
+// Variables take their values from the profile as they are declared, and the
+// nodes of each file are resolved as the file is loaded, so the profile must
+// be known up front; otherwise a profile declared in an included file would
+// not set the variables declared before it. Errors are left to be reported
+// by the load itself.
+func (l *loader) selectProfile(name string, value interface{}, files ...string) {
+	if l.opts.Profile == "" {
+		return
+	}
+	scan := &profileScan{
+		loader:   l,
+		ctx:      impl.CreateErrCtx(name, &errors.ErrorCollector{}),
+		profiles: map[string]*node.Profile{},
+		seen:     map[string]bool{},
+	}
+	if value != nil {
+		if abs, err := filepath.Abs(name); err == nil {
+			scan.seen[abs] = true
+		}
+		scan.value(name, value)
+	}
+	for _, file := range files {
+		scan.file(file)
+	}
+	l.state.Selected = scan.profiles[l.opts.Profile]
+}
+
+// profileScan collects the profiles of a configuration and the files it
+// includes without unpacking anything else.
+type profileScan struct {
+	loader   *loader
+	ctx      *errctx.Context
+	profiles map[string]*node.Profile
+	seen     map[string]bool
+}
+
+func (s *profileScan) value(name string, value interface{}) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if raw, ok := obj[key.Profiles].(map[string]interface{}); ok {
+		impl.UnpackProfiles(s.ctx, raw, s.profiles)
+	}
+	includes, _ := obj[key.Include].([]interface{})
+	for _, include := range includes {
+		path, ok := include.(string)
+		if !ok {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(name), path)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			s.file(path)
+			continue
+		}
+		files, err := s.loader.listDir(path)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			s.file(file)
+		}
+	}
+}
+
+func (s *profileScan) file(filename string) {
+	abs, err := filepath.Abs(filename)
+	if err != nil || s.seen[abs] {
+		return
+	}
+	s.seen[abs] = true
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	value, err := decode(filename, data, errors.NewPositions())
+	if err != nil {
+		return
+	}
+	s.value(filename, value)
+}
+
+// listDir returns the configuration files directly inside a directory in
+// order of filename.
+func (l *loader) listDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
 		return nil, err
 	}
-	n := impl.UnpackNode(ctx, m)
-	if n != nil {
-		return []*node.Node{n}, impl.GetError(ctx)
+	files := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || !IsConfigFile(entry.Name()) {
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+	return files, nil
+}
+
+// checkOverrides reports overrides of variables which the configuration does
+// not declare; those from the environment are reported as warnings.
+func checkOverrides(ctx *errctx.Context, opts *Options, cfg *Config) {
+	for _, name := range undeclared(opts.Vars, cfg) {
+		ctx.ErrorWithKey(fmt.Errorf("override of undeclared variable %q", name), key.Vars)
+	}
+	for _, name := range undeclared(opts.EnvVars, cfg) {
+		if _, ok := opts.Vars[name]; ok {
+			continue
+		}
+		ctx.Path.Add(mpath.Key(key.Vars))
+		impl.Warn(ctx, fmt.Errorf("environment override of undeclared variable %q", name))
+		ctx.Path.Pop()
+	}
+}
+
+// undeclared returns the sorted names of the overrides which the
+// configuration does not declare.
+func undeclared(overrides map[string]string, cfg *Config) []string {
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		if _, ok := cfg.Vars[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkProfileVars reports variables set by the profile which the
+// configuration does not declare.
+func checkProfileVars(ctx *errctx.Context, profile *node.Profile, cfg *Config) {
+	names := make([]string, 0, len(profile.Vars))
+	for name := range profile.Vars {
+		if _, ok := cfg.Vars[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ctx.ErrorWithKey(fmt.Errorf("profile %q sets undeclared variable %q", profile.Name, name), key.Profiles)
 	}
-	return nil, impl.GetError(ctx)
 }
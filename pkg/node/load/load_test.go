@@ -0,0 +1,73 @@
+package load
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tvarney/sdtdmod/pkg/errors"
+)
+
+// TestIncludedProfileVars checks that a profile declared in an included file
+// sets the variables declared before the file is included.
+func TestIncludedProfileVars(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.json": `{
+			"vars": {"mult": 1},
+			"include": ["profiles.json"],
+			"nodes": [{"match": {"type": "tag", "value": "item"}, "actions": [
+				{"type": "update-number", "attr": "value", "mult": "${mult}"}
+			]}]
+		}`,
+		"profiles.json": `{"profiles": {"hard": {"vars": {"mult": 2}}}}`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := LoadFile(filepath.Join(dir, "config.json"), &Options{Profile: "hard"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Vars["mult"]; got != 2.0 {
+		t.Errorf("mult is %v, expected 2", got)
+	}
+	if got := cfg.Nodes[0].Actions[0].Serialize()["mult"]; got != 2.0 {
+		t.Errorf("the action has mult %v, expected 2", got)
+	}
+}
+
+// TestOverrides checks that overrides from the environment give way to those
+// which are set, and that only set overrides of undeclared variables are
+// errors.
+func TestOverrides(t *testing.T) {
+	data := []byte(`{"vars": {"mult": 1}, "nodes": []}`)
+	tests := []struct {
+		name     string
+		opts     *Options
+		mult     interface{}
+		errors   int
+		warnings int
+	}{
+		{"environment", &Options{EnvVars: map[string]string{"mult": "2"}}, 2.0, 0, 0},
+		{"set wins", &Options{Vars: map[string]string{"mult": "3"}, EnvVars: map[string]string{"mult": "2"}}, 3.0, 0, 0},
+		{"undeclared in environment", &Options{EnvVars: map[string]string{"foo": "1"}}, 1.0, 0, 1},
+		{"undeclared set", &Options{Vars: map[string]string{"foo": "1"}}, 1.0, 1, 0},
+		{"undeclared in both", &Options{Vars: map[string]string{"foo": "1"}, EnvVars: map[string]string{"foo": "2"}}, 1.0, 1, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			collector := &errors.ErrorCollector{}
+			cfg, _ := LoadBytes("config.json", data, test.opts, collector)
+			if len(collector.Errors) != test.errors || len(collector.Warnings) != test.warnings {
+				t.Fatalf("got errors %v and warnings %v", collector.Errors, collector.Warnings)
+			}
+			if got := cfg.Vars["mult"]; got != test.mult {
+				t.Errorf("mult is %v, expected %v", got, test.mult)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package load
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tvarney/maputil"
+	"github.com/tvarney/maputil/errctx"
+	"github.com/tvarney/sdtdmod/pkg/errors"
+	"github.com/tvarney/sdtdmod/pkg/node"
+	"github.com/tvarney/sdtdmod/pkg/node/load/impl"
+)
+
+// LoadMatch parses a match given as a string, such as on the command line.
+//
+// A string starting with `{` is a JSON match object as used in configuration
+// files, and errors in it are reported to the handlers under the given name.
+// Anything else is parsed with ParseSelector.
+func LoadMatch(name, s string, handlers ...errctx.ErrorHandler) (node.Match, error) {
+	if !strings.HasPrefix(strings.TrimSpace(s), "{") {
+		return ParseSelector(s)
+	}
+
+	ctx, obj, err := decodeObject(name, s, handlers...)
+	if err != nil {
+		return nil, err
+	}
+	impl.CheckMatchKeys(ctx, obj, false)
+	m := impl.UnpackMatch(ctx, obj)
+	if err := impl.GetError(ctx); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LoadAction parses a JSON action object given as a string.
+//
+// Errors in it are reported to the handlers under the given name.
+func LoadAction(name, s string, handlers ...errctx.ErrorHandler) (node.Action, error) {
+	ctx, obj, err := decodeObject(name, s, handlers...)
+	if err != nil {
+		return nil, err
+	}
+	impl.CheckActionKeys(ctx, obj, false)
+	a := impl.UnpackAction(ctx, obj)
+	if err := impl.GetError(ctx); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// decodeObject decodes a JSON object and returns an error context which
+// reports errors in it with their position.
+func decodeObject(name, s string, handlers ...errctx.ErrorHandler) (*errctx.Context, map[string]interface{}, error) {
+	positions := errors.NewPositions()
+	value, err := decodeJSON(name, []byte(s), positions)
+	if err != nil {
+		return nil, nil, err
+	}
+	obj, err := maputil.AsObject(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx := impl.CreateErrCtx(name, handlers...)
+	ctx.Handler = &errors.PositionHandler{Positions: positions, Handler: ctx.Handler}
+	return ctx, obj, nil
+}
+
+// ParseSelector parses a selector of the form `tag[@attr=value]`.
+//
+// The tag may be `*` to match any element, and is followed by any number of
+// attribute conditions. A condition without a value only requires the
+// attribute to exist.
+func ParseSelector(s string) (node.Match, error) {
+	s = strings.TrimSpace(s)
+	idx := strings.IndexRune(s, '[')
+	if idx < 0 {
+		idx = len(s)
+	}
+	tag, rest := s[:idx], s[idx:]
+	if tag == "" {
+		return nil, fmt.Errorf("selector %q has no tag", s)
+	}
+
+	matches := node.AllOf{}
+	if tag != "*" {
+		matches = append(matches, &node.TagMatch{Value: tag})
+	}
+	for rest != "" {
+		end := strings.IndexRune(rest, ']')
+		if !strings.HasPrefix(rest, "[@") || end < 0 {
+			return nil, fmt.Errorf("invalid attribute condition %q in selector %q", rest, s)
+		}
+		cond := rest[2:end]
+		rest = rest[end+1:]
+
+		m := &node.AttrMatch{Attribute: cond}
+		if eq := strings.IndexRune(cond, '='); eq >= 0 {
+			m.Attribute = cond[:eq]
+			m.Value = strings.Trim(cond[eq+1:], `"'`)
+		}
+		if m.Attribute == "" {
+			return nil, fmt.Errorf("empty attribute name in selector %q", s)
+		}
+		matches = append(matches, m)
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, nil
+	case 1:
+		return matches[0], nil
+	}
+	return matches, nil
+}
@@ -0,0 +1,160 @@
+package load
+
+import (
+	"regexp"
+
+	"github.com/tvarney/sdtdmod/pkg/node/key"
+	"github.com/tvarney/sdtdmod/pkg/node/load/impl"
+)
+
+// SchemaID is the URI of the JSON Schema draft the generated schema uses.
+const SchemaID = "http://json-schema.org/draft-07/schema#"
+
+// Schema returns a JSON Schema describing configuration files.
+//
+// The schema is built from the registry of match and action types used by the
+// loader, so every type in key.MatchTypes and key.ActionTypes is covered.
+func Schema() map[string]interface{} {
+	defs := map[string]interface{}{
+		"var-ref": map[string]interface{}{
+			"type":        "string",
+			"pattern":     `^\$\{[^}]+\}$`,
+			"description": "A reference to a variable.",
+		},
+		"node":    specSchema(impl.NodeSpec, ""),
+		"config":  specSchema(impl.ConfigSpec, ""),
+		"profile": specSchema(impl.ProfileSpec, ""),
+		"test":    specSchema(impl.TestSpec, ""),
+		"expect":  specSchema(impl.ExpectSpec, ""),
+		"attrs": map[string]interface{}{
+			"description": "A list of attribute names, or an object selecting attributes.",
+			"oneOf": []interface{}{
+				map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "minItems": 1},
+				specSchema(impl.AttrSelectorSpec, ""),
+			},
+		},
+	}
+
+	matches := make([]interface{}, 0, len(key.MatchTypes))
+	for _, t := range key.MatchTypes {
+		spec := impl.MatchSpecs[t]
+		defs["match-"+t] = specSchema(&spec.Spec, t)
+		matches = append(matches, ref("match-"+t))
+	}
+	defs["match"] = map[string]interface{}{"oneOf": matches}
+
+	actions := make([]interface{}, 0, len(key.ActionTypes))
+	for _, t := range key.ActionTypes {
+		spec := impl.ActionSpecs[t]
+		defs["action-"+t] = specSchema(&spec.Spec, t)
+		actions = append(actions, ref("action-"+t))
+	}
+	defs["action"] = map[string]interface{}{"oneOf": actions}
+
+	return map[string]interface{}{
+		"$schema":     SchemaID,
+		"title":       "sdtdmod configuration",
+		"definitions": defs,
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "array", "items": ref("node")},
+			ref("config"),
+			ref("node"),
+		},
+	}
+}
+
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/definitions/" + name}
+}
+
+// specSchema returns the schema of an object described by a spec.
+//
+// If typeName is set, the object must have a 'type' key with that value.
+func specSchema(spec *impl.Spec, typeName string) map[string]interface{} {
+	props := map[string]interface{}{}
+	required := []interface{}{}
+	if typeName != "" {
+		props[key.Type] = map[string]interface{}{"const": typeName}
+		required = append(required, key.Type)
+	}
+	for _, f := range spec.Fields {
+		s := fieldSchema(f.Kind)
+		if f.Description != "" {
+			s["description"] = f.Description
+		}
+		if f.Default != nil {
+			s["default"] = f.Default
+		}
+		props[f.Name] = s
+		if f.Required {
+			required = append(required, f.Name)
+		}
+	}
+
+	s := map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"required":             required,
+		"additionalProperties": false,
+		// Extension keys are ignored by the loader wherever they appear.
+		"patternProperties": map[string]interface{}{
+			"^" + regexp.QuoteMeta(impl.ExtensionPrefix): map[string]interface{}{},
+		},
+	}
+	if spec.Description != "" {
+		s["description"] = spec.Description
+	}
+	if len(spec.Alternatives) > 0 {
+		all := make([]interface{}, 0, len(spec.Alternatives))
+		for _, alt := range spec.Alternatives {
+			any := make([]interface{}, 0, len(alt))
+			for _, name := range alt {
+				any = append(any, map[string]interface{}{"required": []interface{}{name}})
+			}
+			all = append(all, map[string]interface{}{"anyOf": any})
+		}
+		s["allOf"] = all
+	}
+	return s
+}
+
+func fieldSchema(kind impl.FieldKind) map[string]interface{} {
+	switch kind {
+	case impl.KindNumber:
+		return map[string]interface{}{"anyOf": []interface{}{map[string]interface{}{"type": "number"}, ref("var-ref")}}
+	case impl.KindInteger:
+		return map[string]interface{}{"anyOf": []interface{}{map[string]interface{}{"type": "integer"}, ref("var-ref")}}
+	case impl.KindBoolean:
+		return map[string]interface{}{"anyOf": []interface{}{map[string]interface{}{"type": "boolean"}, ref("var-ref")}}
+	case impl.KindRegex:
+		return map[string]interface{}{"type": "string", "format": "regex"}
+	case impl.KindStringList:
+		return map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}
+	case impl.KindIntegerList:
+		return map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "integer"}}
+	case impl.KindMatch:
+		return ref("match")
+	case impl.KindMatchList:
+		return map[string]interface{}{"type": "array", "items": ref("match"), "minItems": 1}
+	case impl.KindActionList:
+		return map[string]interface{}{"type": "array", "items": ref("action")}
+	case impl.KindNodeList:
+		return map[string]interface{}{"type": "array", "items": ref("node")}
+	case impl.KindAttrs:
+		return ref("attrs")
+	case impl.KindVars:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": map[string]interface{}{"type": []interface{}{"number", "string", "boolean"}},
+		}
+	case impl.KindStringMap:
+		return map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}}
+	case impl.KindTestList:
+		return map[string]interface{}{"type": "array", "items": ref("test")}
+	case impl.KindExpectList:
+		return map[string]interface{}{"type": "array", "items": ref("expect"), "minItems": 1}
+	case impl.KindProfiles:
+		return map[string]interface{}{"type": "object", "additionalProperties": ref("profile")}
+	}
+	return map[string]interface{}{"type": "string"}
+}
@@ -0,0 +1,121 @@
+package node
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/beevik/etree"
+	"github.com/tvarney/sdtdmod/pkg/loot"
+	"github.com/tvarney/sdtdmod/pkg/node/key"
+)
+
+// ScaleLoot is an Action which scales the chance of loot entries being picked
+// from the loot groups and containers of loot.xml.
+//
+// Every entry naming `Item`, or the group `Group`, in a `lootgroup` or
+// `lootcontainer` the action is applied to has its `prob` set so that the
+// chance of the entry being picked from its list is `Mult` times what it was.
+// Since the chance of each entry depends on the weights of the others, this
+// is not the same as multiplying `prob`. The chance of a container yielding
+// the item through any number of groups is scaled the same way, nearly
+// exactly if the item is rare.
+//
+// Entries which take their weight from a prob template are left alone with a
+// warning, as changing the template would change every entry using it. The
+// weights the templates give other entries are those for the loot `Level`.
+type ScaleLoot struct {
+	Item  string
+	Group string
+	Mult  float64
+	Level float64
+	If    Match
+
+	templates lootTemplates
+}
+
+// lootTemplates holds the loot templates of the document last updated, so
+// that they are read once per document rather than once per list.
+type lootTemplates struct {
+	mutex sync.Mutex
+	root  *etree.Element
+	model *loot.Model
+}
+
+// get returns the templates of the document the element is in.
+func (t *lootTemplates) get(element *etree.Element, level float64) *loot.Model {
+	root := element
+	for root.Parent() != nil && root.Parent().Parent() != nil {
+		root = root.Parent()
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.root != root {
+		t.root = root
+		t.model, _ = loot.Templates(root, level)
+	}
+	return t.model
+}
+
+// Apply updates the entries of the element if it is a loot group or
+// container; other elements are left alone.
+func (s *ScaleLoot) Apply(element *etree.Element, r Reporter) bool {
+	if element.Tag != loot.TagContainer && element.Tag != loot.TagGroup {
+		return false
+	}
+	if s.If != nil && !s.If.Check(element) {
+		return false
+	}
+
+	// The list is read on each call, as other actions may have changed it
+	// since the templates were read.
+	l, err := loot.ParseList(element)
+	if err != nil {
+		r.Warn(element, err)
+		return false
+	}
+	model := s.templates.get(element, s.Level)
+
+	updated := false
+	for _, e := range l.Entries {
+		if (s.Item == "" || e.Item != s.Item) && (s.Group == "" || e.Group != s.Group) {
+			continue
+		}
+		if e.ProbTemplate != "" {
+			r.Warn(e.Element, fmt.Errorf("the chance is set by the prob template %q", e.ProbTemplate))
+			continue
+		}
+		weight, err := model.ScaleWeight(l, e, s.Mult)
+		if err != nil {
+			r.Warn(e.Element, err)
+			continue
+		}
+		value := strconv.FormatFloat(weight, 'f', -1, 64)
+		if rounded, err := strconv.ParseFloat(strconv.FormatFloat(weight, 'f', 6, 64), 64); err == nil && rounded > 0 {
+			value = strconv.FormatFloat(rounded, 'f', -1, 64)
+		}
+		if setAttr(e.Element, loot.AttrProb, value, r) {
+			updated = true
+		}
+		e.Prob = weight
+	}
+	return updated
+}
+
+func (s *ScaleLoot) Serialize() map[string]interface{} {
+	m := map[string]interface{}{
+		key.Type:  key.ActionScaleLoot,
+		key.Mult:  s.Mult,
+		key.Level: s.Level,
+	}
+	if s.Item != "" {
+		m[key.Item] = s.Item
+	}
+	if s.Group != "" {
+		m[key.Group] = s.Group
+	}
+	if s.If != nil {
+		m[key.Cond] = s.If.Serialize()
+	}
+	return m
+}
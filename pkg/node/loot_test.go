@@ -0,0 +1,45 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+func lootDocument(t *testing.T) *etree.Document {
+	doc := etree.NewDocument()
+	err := doc.ReadFromString(`<lootcontainers>
+	<lootgroup name="groupAmmo" count="all">
+		<item name="ammo9mmBulletBall" prob="0.5"/>
+		<item name="ammo762mmBulletBall" prob="0.3"/>
+	</lootgroup>
+</lootcontainers>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// TestScaleLootOnce checks that each loot list is scaled once however many
+// of the elements it is at or under the node matches.
+func TestScaleLootOnce(t *testing.T) {
+	tests := []struct {
+		name  string
+		match Match
+	}{
+		{"no match", nil},
+		{"lootcontainers and lootgroup", AnyOf{&TagMatch{Value: "lootcontainers"}, &TagMatch{Value: "lootgroup"}}},
+		{"lootgroup", &TagMatch{Value: "lootgroup"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			action := &ScaleLoot{Item: "ammo9mmBulletBall", Mult: 0.5, Level: 1}
+			doc := lootDocument(t)
+			applyAll([]*Node{{Match: test.match, Actions: []Action{action}}}, doc.Root(), Discard{})
+			item := doc.FindElement("//item[@name='ammo9mmBulletBall']")
+			if got := item.SelectAttrValue("prob", ""); got != "0.25" {
+				t.Errorf("prob is %s, expected 0.25", got)
+			}
+		})
+	}
+}
@@ -9,6 +9,9 @@ import (
 )
 
 // Match defines an interface for matching elements.
+//
+// Check must not modify the Match, so that a single Match may be used by
+// several goroutines at once.
 type Match interface {
 	Check(*etree.Element) bool
 	Serialize() map[string]interface{}
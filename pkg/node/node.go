@@ -1,39 +1,88 @@
 package node
 
-import "github.com/beevik/etree"
+import (
+	"github.com/beevik/etree"
+	"github.com/tvarney/maputil/mpath"
+)
 
 // Node is a configuration node which may be applied to a xml etree.
+//
+// Tags are used by profiles to select which top-level nodes are applied, and
+// Name by tests to select which nodes they run.
+// Source is the path of the node in the configuration it was loaded from, if
+// known.
 type Node struct {
+	Name     string
 	Match    Match
 	Actions  []Action
 	Children []*Node
+	Tags     []string
+	Source   *mpath.Path
 }
 
 // Apply takes an element of an xml etree, checks for matches, and applies if
 // matched.
-func (n *Node) Apply(element *etree.Element) bool {
-	// If we don't match, don't do anything
-	if !n.Match.Check(element) {
+//
+// A node may be applied to several documents at once as long as each has its
+// own Reporter and none of its actions read other documents; see
+// ReadsDocuments.
+//
+// Any warnings produced by actions are sent to the given Reporter, which is
+// also told of every match and action if it implements Tracker.
+func (n *Node) Apply(element *etree.Element, r Reporter) bool {
+	return n.apply(element, r, nil)
+}
+
+// apply applies the node to the element, using the index of the children of
+// the node if it is given.
+func (n *Node) apply(element *etree.Element, r Reporter, children *Index) bool {
+	// If we don't match, don't do anything. A node without a match applies to
+	// every element it is given.
+	if n.Match != nil && !n.Match.Check(element) {
 		return false
 	}
+	tracker, _ := r.(Tracker)
+	if tracker != nil {
+		tracker.Matched(n, element)
+	}
 
 	updated := false
 	// Iterate over children
 	for _, child := range element.ChildElements() {
+		if children != nil {
+			if children.Apply(child, r) {
+				updated = true
+			}
+			continue
+		}
 		for _, node := range n.Children {
-			updated = updated || node.Apply(child)
+			if node.Apply(child, r) {
+				updated = true
+			}
 		}
 	}
 
 	// Apply any actions
 	for _, action := range n.Actions {
-		updated = updated || action.Apply(element)
+		changed := action.Apply(element, r)
+		if changed {
+			updated = true
+		}
+		if tracker != nil {
+			tracker.Applied(n, action, element, changed)
+		}
 	}
 	return updated
 }
 
 func (n *Node) Serialize() map[string]interface{} {
 	m := map[string]interface{}{}
+	if n.Name != "" {
+		m["name"] = n.Name
+	}
+	if len(n.Tags) > 0 {
+		m["tags"] = n.Tags
+	}
 	if n.Match != nil {
 		m["match"] = n.Match.Serialize()
 	}
@@ -44,5 +93,12 @@ func (n *Node) Serialize() map[string]interface{} {
 		}
 		m["children"] = children
 	}
+	if len(n.Actions) > 0 {
+		actions := make([]map[string]interface{}, 0, len(n.Actions))
+		for _, action := range n.Actions {
+			actions = append(actions, action.Serialize())
+		}
+		m["actions"] = actions
+	}
 	return m
 }
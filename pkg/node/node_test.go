@@ -0,0 +1,151 @@
+package node
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+// testNodes returns nodes using every Match and Action implementation which
+// only reads the document being updated.
+func testNodes() []*Node {
+	number := NewNumber("")
+	number.Attrs = &AttrSelector{Regex: regexp.MustCompile("^(value|weight)$")}
+	number.Mult = 2
+	number.If = Not{Child: &AttrMatch{Attribute: "name", Value: "Fixed"}}
+
+	transform := NewNumber("")
+	transform.Add = 1
+
+	effect := NewNumber("")
+	effect.Mult = 2
+
+	recipe := NewScaleRecipe()
+	recipe.Names = []string{"resourceWood"}
+	recipe.Mult = 2
+	recipe.Output = 2
+
+	return []*Node{
+		{
+			Match: AllOf{
+				&TagMatch{Regex: regexp.MustCompile("^it")},
+				&AttrMatch{Attribute: "name", Prefix: "gun"},
+			},
+			Children: []*Node{{
+				Match:   AnyOf{&TagMatch{Value: "property"}, &TagMatch{Suffix: "effect"}},
+				Actions: []Action{number},
+			}},
+			Actions: []Action{
+				&InsertAttr{Attrs: &AttrSelector{Names: []string{"tagged"}}, Value: "yes"},
+				&RemoveAttr{Attribute: "remove", If: &AttrMatch{Attribute: "remove", Suffix: "me"}},
+			},
+		},
+		{
+			Match: OneOf{&TagMatch{Prefix: "ite"}, &TagMatch{Value: "block"}},
+			Actions: []Action{&CopyFrom{
+				Attribute: "copied",
+				Path:      "/root/base[@name='{@base}']",
+				From:      "value",
+				Transform: transform,
+				If:        &AttrMatch{Attribute: "base"},
+			}},
+		},
+		{
+			Match: &TagMatch{Value: "block"},
+			Actions: []Action{
+				&CloneElement{Set: map[string]string{"name": "{@name}Copy"}},
+				&AppendText{Attribute: "base", Value: "_x"},
+			},
+		},
+		{
+			Match:   &PassiveEffectMatch{Name: "EntityDamage", Operation: "perc_add", Tier: 2},
+			Actions: []Action{&ScalePassiveEffect{Number: effect, Tiers: []int{2}}},
+		},
+		{
+			Match:   &TagMatch{Value: "effect_group"},
+			Actions: []Action{&AddPassiveEffect{Name: "RunSpeed", Operation: "perc_add", Value: "0.1", Tags: []string{"perk"}}},
+		},
+		{
+			Match:   &TagMatch{Value: "lootgroup"},
+			Actions: []Action{&ScaleLoot{Item: "ammo", Mult: 0.5, Level: 1}},
+		},
+		{
+			Match:   &TagMatch{Value: "recipe"},
+			Actions: []Action{recipe},
+		},
+	}
+}
+
+func testDocument(t *testing.T) *etree.Document {
+	b := strings.Builder{}
+	b.WriteString("<root>")
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&b, `<base name="b%d" value="%d"/>`, i, i)
+		fmt.Fprintf(&b, `<item name="gun%d" base="b%d" remove="removeme">`, i, i)
+		fmt.Fprintf(&b, `<property name="Fixed" value="%d"/><property name="Weight" value="%d" weight="1.5"/>`, i, i)
+		fmt.Fprintf(&b, `<passive_effect value="%d"/></item>`, i)
+		fmt.Fprintf(&b, `<block name="block%d" base="b%d"/>`, i, i)
+		fmt.Fprintf(&b, `<effect_group><passive_effect name="EntityDamage" operation="perc_add" value="0.%d,0.2,0.3" tier="1,2,3"/></effect_group>`, i%10)
+		fmt.Fprintf(&b, `<lootgroup name="group%d"><item name="ammo" prob="1"/><item name="other" prob="%d"/></lootgroup>`, i, i%3+1)
+		fmt.Fprintf(&b, `<recipe name="r%d" count="1"><ingredient name="resourceWood" count="%d"/></recipe>`, i, i%5+1)
+	}
+	b.WriteString("</root>")
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(b.String()); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func applyAll(nodes []*Node, element *etree.Element, r Reporter) {
+	for _, n := range nodes {
+		n.Apply(element, r)
+	}
+	for _, child := range element.ChildElements() {
+		applyAll(nodes, child, r)
+	}
+}
+
+// TestConcurrentApply checks that the same nodes may be applied to several
+// documents at once. Run with -race to check for data races.
+func TestConcurrentApply(t *testing.T) {
+	nodes := testNodes()
+	expected := testDocument(t)
+	applyAll(nodes, expected.Root(), Discard{})
+	want, err := expected.WriteToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const workers = 8
+	got := make([]string, workers)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		doc := testDocument(t)
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			applyAll(nodes, doc.Root(), Discard{})
+			got[w], _ = doc.WriteToString()
+		}(w)
+	}
+	wg.Wait()
+
+	for w, s := range got {
+		if s != want {
+			t.Errorf("worker %d produced a different document", w)
+		}
+	}
+	for _, applied := range []string{
+		`copied="6"`, `tagged="yes"`, `<block name="block6" base="b6_x" copied="7"/><block name="block6Copy" base="b6" copied="7"/>`, `value="0.6,0.4,0.3"`,
+		`name="RunSpeed"`, `<item name="ammo" prob="0.333333"/>`, `<recipe name="r6" count="2"><ingredient name="resourceWood" count="4"/>`,
+	} {
+		if !strings.Contains(want, applied) {
+			t.Errorf("nodes were not applied, %s not found: %.200s", applied, want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package node
+
+import "github.com/tvarney/sdtdmod/pkg/node/key"
+
+// Profile is a named selection of the tagged top-level nodes of a
+// configuration along with values for its variables.
+//
+// Untagged nodes are always enabled. A tagged node is enabled unless one of
+// its tags is in `Disable`; if `Enable` is not empty, one of its tags must
+// also be listed there.
+type Profile struct {
+	Name        string
+	Description string
+	Enable      []string
+	Disable     []string
+	Vars        map[string]interface{}
+}
+
+// Enables checks if the profile enables the node.
+func (p *Profile) Enables(n *Node) bool {
+	if len(n.Tags) == 0 {
+		return true
+	}
+	for _, tag := range n.Tags {
+		if contains(p.Disable, tag) {
+			return false
+		}
+	}
+	if len(p.Enable) == 0 {
+		return true
+	}
+	for _, tag := range n.Tags {
+		if contains(p.Enable, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns the nodes which the profile enables.
+func (p *Profile) Filter(nodes []*Node) []*Node {
+	enabled := make([]*Node, 0, len(nodes))
+	for _, n := range nodes {
+		if p.Enables(n) {
+			enabled = append(enabled, n)
+		}
+	}
+	return enabled
+}
+
+// Serialize returns JSON compatible map of this Profile.
+func (p *Profile) Serialize() map[string]interface{} {
+	m := map[string]interface{}{}
+	if p.Description != "" {
+		m[key.Description] = p.Description
+	}
+	if len(p.Enable) > 0 {
+		m[key.Enable] = p.Enable
+	}
+	if len(p.Disable) > 0 {
+		m[key.Disable] = p.Disable
+	}
+	if len(p.Vars) > 0 {
+		m[key.Vars] = p.Vars
+	}
+	return m
+}
@@ -0,0 +1,252 @@
+package node
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/tvarney/sdtdmod/pkg/errors"
+	"github.com/tvarney/sdtdmod/pkg/node/key"
+)
+
+// Tags and attributes of recipes.xml and items.xml used by ScaleRecipe.
+const (
+	RecipeTag      = "recipe"
+	IngredientTag  = "ingredient"
+	RecipeCount    = "count"
+	RecipeTime     = "craft_time"
+	ItemsDocument  = "items.xml"
+	itemTag        = "item"
+	itemProperty   = "property"
+	itemTagsName   = "Tags"
+	itemExtendName = "Extends"
+)
+
+// Rounding modes of ScaleRecipe.
+const (
+	RoundNearest = "nearest"
+	RoundUp      = "up"
+	RoundDown    = "down"
+)
+
+// RoundingModes lists every rounding mode of ScaleRecipe.
+var RoundingModes = []string{RoundNearest, RoundUp, RoundDown}
+
+// ScaleRecipe is an Action which scales the ingredients of `recipe` elements.
+//
+// The `count` of each ingredient named in `Names`, or whose item has one of
+// `Tags` in items.xml, is multiplied by `Mult`, rounded to a whole number
+// using `Round`, and raised to `Min` if it falls below it. If neither `Names`
+// nor `Tags` is set, every ingredient is scaled.
+//
+// If `Time` is set, the craft time of each recipe with a scaled ingredient is
+// updated by it. If `Output` is set, the number of items each such recipe
+// makes is multiplied by it and rounded like an ingredient count.
+type ScaleRecipe struct {
+	Names  []string
+	Tags   []string
+	Mult   float64
+	Round  string
+	Min    int
+	Time   *Number
+	Output float64
+	If     Match
+}
+
+// NewScaleRecipe returns a ScaleRecipe Action which leaves recipes unchanged.
+func NewScaleRecipe() *ScaleRecipe {
+	return &ScaleRecipe{Mult: 1, Round: RoundNearest, Min: 1, Output: 1}
+}
+
+// Apply updates the element if it is a recipe; other elements are left
+// alone.
+//
+// Ingredients whose count is not a whole number are left alone with a
+// warning. If `Tags` is set and items.xml can not be found, no ingredient is
+// scaled and a warning is reported.
+func (s *ScaleRecipe) Apply(element *etree.Element, r Reporter) bool {
+	if element.Tag != RecipeTag {
+		return false
+	}
+	if s.If != nil && !s.If.Check(element) {
+		return false
+	}
+
+	var items *itemTags
+	if len(s.Tags) > 0 {
+		resolver, ok := r.(Resolver)
+		var doc *etree.Document
+		if ok {
+			doc = resolver.Resolve(ItemsDocument)
+		}
+		if doc == nil {
+			r.Warn(element, errors.MissingSourceError(ItemsDocument))
+			return false
+		}
+		items = newItemTags(doc)
+	}
+
+	updated := false
+	scaled := false
+	for _, ingredient := range element.SelectElements(IngredientTag) {
+		if !s.selects(ingredient, items) {
+			continue
+		}
+		count, err := wholeCount(ingredient)
+		if err != nil {
+			r.Warn(ingredient, err)
+			continue
+		}
+		scaled = true
+		if s.setCount(ingredient, s.scale(count, s.Mult), r) {
+			updated = true
+		}
+	}
+	if !scaled {
+		return updated
+	}
+
+	if s.Time != nil && element.SelectAttr(RecipeTime) != nil {
+		if s.Time.Apply(element, r) {
+			updated = true
+		}
+	}
+	if s.Output != 1 {
+		count, err := wholeCount(element)
+		if err != nil {
+			r.Warn(element, err)
+			return updated
+		}
+		if s.setCount(element, s.scale(count, s.Output), r) {
+			updated = true
+		}
+	}
+	return updated
+}
+
+// selects checks if the ingredient is one the action scales.
+func (s *ScaleRecipe) selects(ingredient *etree.Element, items *itemTags) bool {
+	if len(s.Names) == 0 && len(s.Tags) == 0 {
+		return true
+	}
+	name := ingredient.SelectAttrValue(key.Name, "")
+	if contains(s.Names, name) {
+		return true
+	}
+	if items != nil {
+		for _, tag := range items.tags(name) {
+			if contains(s.Tags, tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scale multiplies the count, rounds it, and raises it to the minimum.
+func (s *ScaleRecipe) scale(count int, mult float64) int {
+	v := float64(count) * mult
+	switch s.Round {
+	case RoundUp:
+		// Allow for values like 2.0000000001 which are whole numbers apart
+		// from floating point error.
+		v = math.Ceil(v - 1e-9)
+	case RoundDown:
+		v = math.Floor(v + 1e-9)
+	default:
+		v = math.Round(v)
+	}
+	if v < float64(s.Min) {
+		v = float64(s.Min)
+	}
+	return int(v)
+}
+
+// setCount sets the count of the element, leaving out the attribute if it
+// was left out and the count is the default of 1.
+func (s *ScaleRecipe) setCount(element *etree.Element, count int, r Reporter) bool {
+	if element.SelectAttr(RecipeCount) == nil && count == 1 {
+		return false
+	}
+	return setAttr(element, RecipeCount, strconv.Itoa(count), r)
+}
+
+// wholeCount returns the count of an ingredient or recipe, which is 1 if it
+// is not given.
+func wholeCount(element *etree.Element) (int, error) {
+	raw := element.SelectAttrValue(RecipeCount, "1")
+	count, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		return 0, fmt.Errorf("%s %q is not a whole number", RecipeCount, raw)
+	}
+	return count, nil
+}
+
+func (s *ScaleRecipe) Serialize() map[string]interface{} {
+	m := map[string]interface{}{
+		key.Type:  key.ActionScaleRecipe,
+		key.Mult:  s.Mult,
+		key.Round: s.Round,
+		key.Min:   s.Min,
+	}
+	if len(s.Names) > 0 {
+		m[key.Names] = s.Names
+	}
+	if len(s.Tags) > 0 {
+		m[key.Tags] = s.Tags
+	}
+	if s.Time != nil {
+		m[key.CraftTime] = s.Time.Mult
+	}
+	if s.Output != 1 {
+		m[key.OutputCount] = s.Output
+	}
+	if s.If != nil {
+		m[key.Cond] = s.If.Serialize()
+	}
+	return m
+}
+
+// itemTags looks up the tags of items in items.xml, including those they
+// inherit through `Extends`.
+type itemTags struct {
+	items map[string]*etree.Element
+}
+
+func newItemTags(doc *etree.Document) *itemTags {
+	t := &itemTags{items: map[string]*etree.Element{}}
+	if root := doc.Root(); root != nil {
+		for _, item := range root.SelectElements(itemTag) {
+			t.items[item.SelectAttrValue(key.Name, "")] = item
+		}
+	}
+	return t
+}
+
+func (t *itemTags) tags(name string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for name != "" && !seen[name] {
+		seen[name] = true
+		item := t.items[name]
+		if item == nil {
+			break
+		}
+		name = ""
+		for _, prop := range item.SelectElements(itemProperty) {
+			switch prop.SelectAttrValue(key.Name, "") {
+			case itemTagsName:
+				for _, tag := range strings.Split(prop.SelectAttrValue(key.Value, ""), ",") {
+					if tag = strings.TrimSpace(tag); tag != "" {
+						tags = append(tags, tag)
+					}
+				}
+			case itemExtendName:
+				name = prop.SelectAttrValue(key.Value, "")
+			}
+		}
+	}
+	return tags
+}
@@ -0,0 +1,42 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+func recipeDocument(t *testing.T) *etree.Document {
+	doc := etree.NewDocument()
+	err := doc.ReadFromString(`<recipes>
+	<recipe name="gunPistol" count="1"><ingredient name="resourceForgedIron" count="10"/></recipe>
+</recipes>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// TestScaleRecipeOnce checks that each recipe is scaled once however many of
+// the elements it is at or under the node matches.
+func TestScaleRecipeOnce(t *testing.T) {
+	tests := []struct {
+		name  string
+		match Match
+	}{
+		{"no match", nil},
+		{"recipes and recipe", AnyOf{&TagMatch{Value: "recipes"}, &TagMatch{Value: "recipe"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			action := NewScaleRecipe()
+			action.Mult = 2
+			doc := recipeDocument(t)
+			applyAll([]*Node{{Match: test.match, Actions: []Action{action}}}, doc.Root(), Discard{})
+			ingredient := doc.FindElement("//ingredient")
+			if got := ingredient.SelectAttrValue(RecipeCount, ""); got != "20" {
+				t.Errorf("count is %s, expected 20", got)
+			}
+		})
+	}
+}
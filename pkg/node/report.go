@@ -0,0 +1,82 @@
+package node
+
+import "github.com/beevik/etree"
+
+// Change describes a modification of a single attribute of an element.
+//
+// An attribute which did not exist before the change has `Added` set, and one
+// which was deleted has `Removed` set.
+type Change struct {
+	Element *etree.Element
+	Attr    string
+	Old     string
+	New     string
+	Added   bool
+	Removed bool
+}
+
+// Reporter receives diagnostics produced while applying nodes to elements.
+type Reporter interface {
+	Change(c Change)
+	Warn(element *etree.Element, err error)
+}
+
+// Resolver is implemented by Reporters which are able to find the other
+// documents of the data being updated.
+//
+// Actions which read from other files use this to locate them; if the
+// Reporter passed to them does not implement Resolver, only the document of
+// the element being updated is available.
+type Resolver interface {
+	Resolve(name string) *etree.Document
+}
+
+// Tracker is implemented by Reporters which record how nodes are applied.
+//
+// Matched is called when a node matches an element, before its children and
+// actions are applied. Applied is called after each action of the node is
+// applied to the element, with whether the action changed it.
+type Tracker interface {
+	Matched(n *Node, element *etree.Element)
+	Applied(n *Node, a Action, element *etree.Element, changed bool)
+}
+
+// Discard is a Reporter which ignores everything reported to it.
+type Discard struct{}
+
+// Change does nothing with the given change.
+func (Discard) Change(c Change) {}
+
+// Warn does nothing with the given warning.
+func (Discard) Warn(element *etree.Element, err error) {}
+
+var _ Reporter = Discard{}
+
+// setAttr sets the attribute of the element to the value and reports the
+// change, returning false if the attribute already had that value.
+func setAttr(element *etree.Element, name, value string, r Reporter) bool {
+	attr := element.SelectAttr(name)
+	if attr == nil {
+		element.CreateAttr(name, value)
+		r.Change(Change{Element: element, Attr: name, New: value, Added: true})
+		return true
+	}
+	if attr.Value == value {
+		return false
+	}
+	old := attr.Value
+	attr.Value = value
+	r.Change(Change{Element: element, Attr: name, Old: old, New: value})
+	return true
+}
+
+// removeAttr removes the attribute from the element and reports the change,
+// returning false if the element did not have the attribute.
+func removeAttr(element *etree.Element, name string, r Reporter) bool {
+	attr := element.RemoveAttr(name)
+	if attr == nil {
+		return false
+	}
+	r.Change(Change{Element: element, Attr: name, Old: attr.Value, Removed: true})
+	return true
+}
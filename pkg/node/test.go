@@ -0,0 +1,30 @@
+package node
+
+import "github.com/tvarney/maputil/mpath"
+
+// Test is a test case for the nodes of a configuration.
+//
+// The top-level nodes named by Nodes, or every top-level node if it is empty,
+// are applied to the Input XML. The result must be equal to Output if it is
+// set, ignoring whitespace between elements and the order of attributes, and
+// must satisfy every Expectation.
+//
+// Source is the path of the test in the configuration it was loaded from.
+type Test struct {
+	Name   string
+	Nodes  []string
+	Input  string
+	Output string
+	Expect []Expectation
+	Source *mpath.Path
+}
+
+// Expectation checks the value of an attribute of the first element selected
+// by Path, which is an etree path. If Absent is set, the element must not have
+// the attribute.
+type Expectation struct {
+	Path   string
+	Attr   string
+	Value  string
+	Absent bool
+}
@@ -0,0 +1,449 @@
+// Package shell implements an interactive session for exploring game data and
+// trying out matches and actions on it.
+package shell
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/peterh/liner"
+	"github.com/tvarney/sdtdmod/pkg/errors"
+	"github.com/tvarney/sdtdmod/pkg/gamedata"
+	"github.com/tvarney/sdtdmod/pkg/node"
+	"github.com/tvarney/sdtdmod/pkg/node/load"
+)
+
+// Prompt is the prompt shown before each line of input.
+const Prompt = "sdtdmod> "
+
+const help = `Enter a JSON match or a selector like 'item[@name=gunPistol]' to list the
+elements it selects. Commands:
+  :apply <action>   apply a JSON action to the selected elements
+  :undo             revert the last :apply
+  :save <file>      append the match and applied actions as a node to a JSON config
+  :show             list the selected elements again
+  :format <format>  set the output format to table, xml, or json
+  :context <n>      show n ancestors of each element
+  :help             show this help
+  :quit             leave the shell
+Changes are only made to the data in memory.`
+
+var commands = []string{":apply", ":undo", ":save", ":show", ":format", ":context", ":help", ":quit"}
+
+// Shell is an interactive session over a set of loaded documents.
+type Shell struct {
+	Docs []*gamedata.Document
+	Out  io.Writer
+	// HistoryFile is where input history is kept between sessions, if set.
+	HistoryFile string
+
+	format  string
+	context int
+
+	match    node.Match
+	hasQuery bool
+	results  []gamedata.QueryResult
+	actions  []node.Action
+	undo     []edit
+
+	tags   []string
+	attrs  []string
+	values []string
+}
+
+// edit is the set of changes made by one action and the elements it
+// inserted, along with whether the action belongs to the current match.
+type edit struct {
+	changes  []node.Change
+	inserted []*etree.Element
+	current  bool
+}
+
+// New returns a shell over the documents which writes to out.
+func New(docs []*gamedata.Document, out io.Writer) *Shell {
+	s := &Shell{Docs: docs, Out: out, format: "table"}
+	s.index()
+	return s
+}
+
+// index collects the tag names, attribute names, and attribute values of the
+// documents for completion.
+func (s *Shell) index() {
+	tags, attrs, values := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for _, doc := range s.Docs {
+		walkElements(doc.Tree.Root(), func(e *etree.Element) bool {
+			tags[e.Tag] = true
+			for _, attr := range e.Attr {
+				attrs[attr.FullKey()] = true
+				values[attr.Value] = true
+			}
+			return true
+		})
+	}
+	s.tags, s.attrs, s.values = sortedSet(tags), sortedSet(attrs), sortedSet(values)
+}
+
+func sortedSet(set map[string]bool) []string {
+	list := make([]string, 0, len(set))
+	for item := range set {
+		list = append(list, item)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Run reads and executes lines until the input ends or :quit is entered.
+func (s *Shell) Run() error {
+	line := liner.NewLiner()
+	defer line.Close()
+	line.SetCtrlCAborts(true)
+	line.SetWordCompleter(s.complete)
+	if s.HistoryFile != "" {
+		if f, err := os.Open(s.HistoryFile); err == nil {
+			line.ReadHistory(f)
+			f.Close()
+		}
+	}
+
+	fmt.Fprintln(s.Out, help)
+	for {
+		input, err := line.Prompt(Prompt)
+		if err == liner.ErrPromptAborted {
+			continue
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+		line.AppendHistory(input)
+		if !s.Exec(input) {
+			break
+		}
+	}
+
+	if s.HistoryFile != "" {
+		f, err := os.Create(s.HistoryFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := line.WriteHistory(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Exec executes a single line of input, returning false if the shell should
+// exit.
+func (s *Shell) Exec(input string) bool {
+	cmd, arg := input, ""
+	if idx := strings.IndexAny(input, " \t"); idx >= 0 {
+		cmd, arg = input[:idx], strings.TrimSpace(input[idx+1:])
+	}
+	if !strings.HasPrefix(cmd, ":") {
+		s.query(input)
+		return true
+	}
+
+	var err error
+	switch cmd {
+	case ":quit", ":q", ":exit":
+		return false
+	case ":help":
+		fmt.Fprintln(s.Out, help)
+	case ":show":
+		err = s.show()
+	case ":apply":
+		err = s.apply(arg)
+	case ":undo":
+		err = s.revert()
+	case ":save":
+		err = s.save(arg)
+	case ":format":
+		switch arg {
+		case "table", "xml", "json":
+			s.format = arg
+		default:
+			err = fmt.Errorf("unknown format %q", arg)
+		}
+	case ":context":
+		var n int
+		n, err = strconv.Atoi(arg)
+		if err == nil && n < 0 {
+			err = fmt.Errorf("context may not be negative")
+		}
+		if err == nil {
+			s.context = n
+		}
+	default:
+		err = fmt.Errorf("unknown command %q; enter :help for a list of commands", cmd)
+	}
+	if err != nil {
+		fmt.Fprintf(s.Out, "Error: %v\n", err)
+	}
+	return true
+}
+
+func (s *Shell) query(input string) {
+	m, err := load.LoadMatch("match", input, &errors.ErrorPrinter{Stream: s.Out})
+	if err != nil {
+		fmt.Fprintf(s.Out, "Error: %v\n", err)
+		return
+	}
+	s.match = m
+	s.hasQuery = true
+	s.results = gamedata.Query(m, s.Docs)
+	s.actions = nil
+	for idx := range s.undo {
+		s.undo[idx].current = false
+	}
+	if err := s.show(); err != nil {
+		fmt.Fprintf(s.Out, "Error: %v\n", err)
+	}
+}
+
+func (s *Shell) show() error {
+	if !s.hasQuery {
+		return fmt.Errorf("no match entered yet")
+	}
+	var err error
+	switch s.format {
+	case "xml":
+		err = gamedata.WriteQueryXML(s.Out, s.results, s.context)
+	case "json":
+		err = gamedata.WriteQueryJSON(s.Out, s.results, s.context)
+	default:
+		err = gamedata.WriteQueryTable(s.Out, s.results, s.context)
+	}
+	fmt.Fprintf(s.Out, "%d elements selected\n", len(s.results))
+	return err
+}
+
+// changeLog is a Reporter which keeps the changes reported to it.
+type changeLog struct {
+	*gamedata.Printer
+	changes []node.Change
+}
+
+func (c *changeLog) Change(change node.Change) {
+	c.changes = append(c.changes, change)
+	c.Printer.Change(change)
+}
+
+func (s *Shell) apply(raw string) error {
+	if !s.hasQuery {
+		return fmt.Errorf("no match entered yet")
+	}
+	if raw == "" {
+		return fmt.Errorf(":apply requires a JSON action")
+	}
+	a, err := load.LoadAction("action", raw, &errors.ErrorPrinter{Stream: s.Out})
+	if err != nil {
+		return err
+	}
+	if a == nil {
+		return fmt.Errorf("action type is not implemented")
+	}
+
+	docs := resultDocuments(s.results)
+	before := elementSet(docs)
+	log := &changeLog{Printer: &gamedata.Printer{Stream: s.Out, Changes: s.Out, Documents: s.Docs}}
+	for _, r := range s.results {
+		log.Document = r.Document.Name
+		a.Apply(r.Element, log)
+	}
+	inserted := insertedElements(docs, before)
+	s.actions = append(s.actions, a)
+	s.undo = append(s.undo, edit{changes: log.changes, inserted: inserted, current: true})
+	fmt.Fprintf(s.Out, "%d attributes changed\n", len(log.changes))
+	if len(inserted) > 0 {
+		fmt.Fprintf(s.Out, "%d elements inserted\n", len(inserted))
+	}
+	return nil
+}
+
+// resultDocuments returns the documents of the results, each once.
+func resultDocuments(results []gamedata.QueryResult) []*gamedata.Document {
+	seen := map[*gamedata.Document]bool{}
+	docs := []*gamedata.Document{}
+	for _, r := range results {
+		if !seen[r.Document] {
+			seen[r.Document] = true
+			docs = append(docs, r.Document)
+		}
+	}
+	return docs
+}
+
+// elementSet returns every element of the documents.
+func elementSet(docs []*gamedata.Document) map[*etree.Element]bool {
+	set := map[*etree.Element]bool{}
+	for _, doc := range docs {
+		walkElements(doc.Tree.Root(), func(e *etree.Element) bool {
+			set[e] = true
+			return true
+		})
+	}
+	return set
+}
+
+// insertedElements returns the elements of the documents which are not in
+// before, leaving out those inside another inserted element.
+func insertedElements(docs []*gamedata.Document, before map[*etree.Element]bool) []*etree.Element {
+	var inserted []*etree.Element
+	for _, doc := range docs {
+		walkElements(doc.Tree.Root(), func(e *etree.Element) bool {
+			if before[e] {
+				return true
+			}
+			inserted = append(inserted, e)
+			return false
+		})
+	}
+	return inserted
+}
+
+// walkElements calls fn for the element and its descendants in document
+// order, skipping the descendants of elements for which fn returns false.
+func walkElements(e *etree.Element, fn func(e *etree.Element) bool) {
+	if e == nil || !fn(e) {
+		return
+	}
+	for _, child := range e.ChildElements() {
+		walkElements(child, fn)
+	}
+}
+
+// revert undoes the changes of the last action, most recent first, and
+// removes the elements it inserted.
+func (s *Shell) revert() error {
+	if len(s.undo) == 0 {
+		return fmt.Errorf("nothing to undo")
+	}
+	last := s.undo[len(s.undo)-1]
+	s.undo = s.undo[:len(s.undo)-1]
+	for idx := len(last.changes) - 1; idx >= 0; idx-- {
+		c := last.changes[idx]
+		if c.Added {
+			c.Element.RemoveAttr(c.Attr)
+		} else {
+			c.Element.CreateAttr(c.Attr, c.Old)
+		}
+	}
+	for idx := len(last.inserted) - 1; idx >= 0; idx-- {
+		e := last.inserted[idx]
+		if parent := e.Parent(); parent != nil {
+			parent.RemoveChild(e)
+		}
+	}
+	if last.current && len(s.actions) > 0 {
+		s.actions = s.actions[:len(s.actions)-1]
+	}
+	fmt.Fprintf(s.Out, "%d attributes restored\n", len(last.changes))
+	if len(last.inserted) > 0 {
+		fmt.Fprintf(s.Out, "%d elements removed\n", len(last.inserted))
+	}
+	return nil
+}
+
+// save appends a node made of the current match and the actions applied since
+// it was entered to a JSON config file.
+//
+// The file may hold a list of nodes or a config object with a 'nodes' key,
+// and is created if it does not exist. Comments in the file are not kept.
+func (s *Shell) save(filename string) error {
+	if filename == "" {
+		return fmt.Errorf(":save requires a file name")
+	}
+	if load.FormatOf(filename) != load.FormatJSON {
+		return fmt.Errorf("only JSON configs may be saved to")
+	}
+	if !s.hasQuery {
+		return fmt.Errorf("no match entered yet")
+	}
+	if len(s.actions) == 0 {
+		return fmt.Errorf("no actions applied to the current match")
+	}
+
+	n := &node.Node{Match: s.match, Actions: s.actions}
+	var value interface{} = []interface{}{}
+	data, err := os.ReadFile(filename)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(load.StripComments(data), &value); err != nil {
+			return err
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		value = append(v, n.Serialize())
+	case map[string]interface{}:
+		nodes, _ := v["nodes"].([]interface{})
+		v["nodes"] = append(nodes, n.Serialize())
+	default:
+		return fmt.Errorf("%s does not hold a list of nodes or a config object", filename)
+	}
+
+	out, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filename, append(out, '\n'), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.Out, "Saved node with %d actions to %s\n", len(s.actions), filename)
+	return nil
+}
+
+// complete completes the word before the cursor.
+//
+// Commands are completed at the start of the line, attribute names after `@`,
+// attribute values after `=`, and any name or value inside quotes. Other
+// words are completed as tag names.
+func (s *Shell) complete(line string, pos int) (string, []string, string) {
+	head, tail := line[:pos], line[pos:]
+	start := strings.LastIndexAny(head, " []@=\"'{},:") + 1
+	word := head[start:]
+
+	var candidates []string
+	prev := byte(0)
+	if start > 0 {
+		prev = head[start-1]
+	}
+	switch {
+	case strings.HasPrefix(head, ":") && !strings.ContainsAny(head, " \t"):
+		start, word, candidates = 0, head, commands
+	case prev == '@':
+		candidates = s.attrs
+	case prev == '=':
+		candidates = s.values
+	case prev == '"' || prev == '\'':
+		candidates = append(append(append([]string{}, s.tags...), s.attrs...), s.values...)
+	default:
+		candidates = s.tags
+	}
+
+	completions := []string{}
+	for _, c := range candidates {
+		if strings.HasPrefix(c, word) {
+			completions = append(completions, c)
+		}
+	}
+	return head[:start], completions, tail
+}
@@ -0,0 +1,41 @@
+package shell
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/tvarney/sdtdmod/pkg/gamedata"
+)
+
+// TestUndoInserted checks that undoing an action removes the elements it
+// inserted along with restoring the attributes it changed.
+func TestUndoInserted(t *testing.T) {
+	const input = `<items><item name="a"><effect_group/></item><item name="b"><effect_group/></item></items>`
+	tests := []struct {
+		name   string
+		query  string
+		action string
+	}{
+		{"clone-element", `{"type": "tag", "value": "item"}`, `{"type": "clone-element", "set": {"name": "{@name}Copy"}}`},
+		{"add-passive-effect", `{"type": "tag", "value": "effect_group"}`, `{"type": "add-passive-effect", "name": "EntityDamage", "operation": "perc_add", "value": "0.1"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree := etree.NewDocument()
+			if err := tree.ReadFromString(input); err != nil {
+				t.Fatal(err)
+			}
+			s := New([]*gamedata.Document{{Name: "items.xml", Tree: tree}}, ioutil.Discard)
+			s.Exec(test.query)
+			s.Exec(":apply " + test.action)
+			if got, _ := tree.WriteToString(); got == input {
+				t.Fatalf("the action changed nothing")
+			}
+			s.Exec(":undo")
+			if got, _ := tree.WriteToString(); got != input {
+				t.Errorf("after undo the document is\n%s\nexpected\n%s", got, input)
+			}
+		})
+	}
+}
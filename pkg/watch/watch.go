@@ -0,0 +1,178 @@
+// Package watch reports changes to the files used by a command so that it can
+// be run again.
+package watch
+
+import (
+	"crypto/sha256"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultDelay is how long Wait waits for further events after the first one,
+// so that a burst of writes is reported as a single change.
+const DefaultDelay = 200 * time.Millisecond
+
+// Watcher waits for changes to a set of files and directory trees.
+//
+// The directories containing watched files are watched rather than the files
+// themselves, so that files replaced by editors on save are still seen.
+type Watcher struct {
+	Delay time.Duration
+
+	fs      *fsnotify.Watcher
+	files   map[string]bool
+	trees   []string
+	dirs    map[string]bool
+	written map[string][sha256.Size]byte
+}
+
+// New returns a Watcher which is not watching anything yet.
+func New() (*Watcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &Watcher{
+		Delay:   DefaultDelay,
+		fs:      w,
+		files:   map[string]bool{},
+		dirs:    map[string]bool{},
+		written: map[string][sha256.Size]byte{},
+	}, nil
+}
+
+// Close stops watching.
+func (w *Watcher) Close() error {
+	return w.fs.Close()
+}
+
+// Set replaces what is watched with the given files and every directory
+// under the given trees. Directories given as files are watched as trees.
+func (w *Watcher) Set(files []string, trees []string) error {
+	dirs := map[string]bool{}
+	w.files = map[string]bool{}
+	trees = append([]string{}, trees...)
+	for _, f := range files {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return err
+		}
+		if info, err := os.Stat(abs); err == nil && info.IsDir() {
+			trees = append(trees, abs)
+			continue
+		}
+		w.files[abs] = true
+		dirs[filepath.Dir(abs)] = true
+	}
+
+	w.trees = w.trees[:0]
+	for _, tree := range trees {
+		abs, err := filepath.Abs(tree)
+		if err != nil {
+			return err
+		}
+		w.trees = append(w.trees, abs)
+		err = filepath.WalkDir(abs, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				dirs[path] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for dir := range w.dirs {
+		if !dirs[dir] {
+			w.fs.Remove(dir)
+		}
+	}
+	for dir := range dirs {
+		if !w.dirs[dir] {
+			if err := w.fs.Add(dir); err != nil {
+				return err
+			}
+		}
+	}
+	w.dirs = dirs
+	return nil
+}
+
+// Written records that the command itself wrote the data to the file, so
+// that the change is not reported as long as the file still holds it.
+func (w *Watcher) Written(path string, data []byte) {
+	if abs, err := filepath.Abs(path); err == nil {
+		w.written[abs] = sha256.Sum256(data)
+	}
+}
+
+// Wait blocks until a watched file, or a file under a watched tree, changes
+// and returns the paths which changed.
+func (w *Watcher) Wait() ([]string, error) {
+	changed := map[string]bool{}
+	var timer <-chan time.Time
+	for {
+		select {
+		case event, ok := <-w.fs.Events:
+			if !ok {
+				return nil, nil
+			}
+			if w.relevant(event.Name) {
+				changed[event.Name] = true
+				timer = time.After(w.Delay)
+			}
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return nil, nil
+			}
+			return nil, err
+		case <-timer:
+			paths := []string{}
+			for path := range changed {
+				if !w.unchanged(path) {
+					paths = append(paths, path)
+				}
+			}
+			if len(paths) > 0 {
+				sort.Strings(paths)
+				return paths, nil
+			}
+			changed = map[string]bool{}
+			timer = nil
+		}
+	}
+}
+
+func (w *Watcher) relevant(path string) bool {
+	if w.files[path] {
+		return true
+	}
+	for _, tree := range w.trees {
+		rel, err := filepath.Rel(tree, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// unchanged checks if the file still holds the data last written to it by
+// the command.
+func (w *Watcher) unchanged(path string) bool {
+	sum, ok := w.written[path]
+	if !ok {
+		return false
+	}
+	data, err := os.ReadFile(path)
+	return err == nil && sha256.Sum256(data) == sum
+}